@@ -1,15 +1,24 @@
 package response
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
 )
 
+// Response doubles as an RFC 7807 problem details object when written with
+// Problem, Status and Error stay for clients of the plain form.
 type Response struct {
-	Status string `json:"status"`
-	Error  string `json:"error,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Code     int    `json:"code,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
 }
 
 const (
@@ -17,6 +26,8 @@ const (
 	StatusError = "Error"
 )
 
+const ContentTypeProblem = "application/problem+json"
+
 func OK() Response {
 	return Response{
 		Status: StatusOK,
@@ -39,6 +50,10 @@ func ValidationError(errs validator.ValidationErrors) Response {
 			errMsgs = append(errMsgs, fmt.Sprintf("field %s is a required field", err.Field()))
 		case "url":
 			errMsgs = append(errMsgs, fmt.Sprintf("field %s is not a valid URL", err.Field()))
+		case "excluded_with":
+			errMsgs = append(errMsgs, fmt.Sprintf("field %s cannot be used with %s", err.Field(), err.Param()))
+		case "lte":
+			errMsgs = append(errMsgs, fmt.Sprintf("field %s must be at most %s", err.Field(), err.Param()))
 		default:
 			errMsgs = append(errMsgs, fmt.Sprintf("field %s is not valid", err.Field()))
 		}
@@ -49,3 +64,16 @@ func ValidationError(errs validator.ValidationErrors) Response {
 		Error:  strings.Join(errMsgs, ", "),
 	}
 }
+
+// Problem writes resp as application/problem+json with the given HTTP status code.
+func Problem(w http.ResponseWriter, r *http.Request, code int, resp Response) {
+	resp.Type = "about:blank"
+	resp.Title = http.StatusText(code)
+	resp.Code = code
+	resp.Detail = resp.Error
+	resp.Instance = r.URL.Path
+
+	w.Header().Set("Content-Type", ContentTypeProblem)
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
+}
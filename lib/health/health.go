@@ -0,0 +1,137 @@
+// Package health serves liveness and readiness probes of a service.
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/raisultan/url-shortener/lib/api/response"
+	"golang.org/x/exp/slog"
+)
+
+// Check pings a dependency of the service. An Optional dependency is
+// reported, but the service serves requests without it.
+type Check struct {
+	Name     string
+	Ping     func(ctx context.Context) error
+	Optional bool
+}
+
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Latency  string `json:"latency"`
+	Critical bool   `json:"critical"`
+}
+
+type Response struct {
+	response.Response
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type Health struct {
+	checks       []Check
+	timeout      time.Duration
+	shuttingDown atomic.Bool
+}
+
+// New checks dependencies with timeout each, all checks run at once.
+func New(timeout time.Duration, checks ...Check) *Health {
+	return &Health{checks: checks, timeout: timeout}
+}
+
+// Shutdown fails readiness, so the instance stops getting traffic while it
+// drains requests in flight.
+func (h *Health) Shutdown() {
+	h.shuttingDown.Store(true)
+}
+
+// Live reports that the process serves requests, dependencies are not
+// checked so their outage doesn't restart every instance.
+func (h *Health) Live() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, response.OK())
+	}
+}
+
+// Ready reports the status of every dependency and answers 503 Service
+// Unavailable if a critical one fails or the service is shutting down.
+func (h *Health) Ready(log *slog.Logger) http.HandlerFunc {
+	log = log.With(slog.String("component", "health"))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.shuttingDown.Load() {
+			response.Problem(w, r, http.StatusServiceUnavailable, response.Error("shutting down"))
+			return
+		}
+
+		checks := h.run(r.Context())
+
+		ready := true
+		for name, check := range checks {
+			if check.Status != response.StatusOK {
+				ready = ready && !check.Critical
+				log.Warn("dependency is not ready",
+					slog.String("dependency", name),
+					slog.String("error", check.Error),
+					slog.Bool("critical", check.Critical),
+				)
+			}
+		}
+
+		if !ready {
+			render.Status(r, http.StatusServiceUnavailable)
+			render.JSON(w, r, Response{
+				Response: response.Error("dependencies are not ready"),
+				Checks:   checks,
+			})
+			return
+		}
+
+		render.JSON(w, r, Response{
+			Response: response.OK(),
+			Checks:   checks,
+		})
+	}
+}
+
+func (h *Health) run(ctx context.Context) map[string]CheckResult {
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		res = make(map[string]CheckResult, len(h.checks))
+	)
+
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, h.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.Ping(ctx)
+			result := CheckResult{
+				Status:   response.StatusOK,
+				Latency:  time.Since(start).String(),
+				Critical: !check.Optional,
+			}
+			if err != nil {
+				result.Status = response.StatusError
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			res[check.Name] = result
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	return res
+}
@@ -0,0 +1,92 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/raisultan/url-shortener/lib/api/response"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+func TestReady(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(httptest.NewRecorder(), nil))
+	ok := Check{Name: "ok", Ping: func(context.Context) error { return nil }}
+	failing := Check{Name: "failing", Ping: func(context.Context) error { return errors.New("unavailable") }}
+	hanging := Check{Name: "hanging", Ping: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+	optional := Check{Name: "optional", Ping: failing.Ping, Optional: true}
+
+	tests := []struct {
+		name     string
+		checks   []Check
+		shutdown bool
+		code     int
+		statuses map[string]string
+	}{
+		{
+			name:     "ready",
+			checks:   []Check{ok},
+			code:     http.StatusOK,
+			statuses: map[string]string{"ok": response.StatusOK},
+		},
+		{
+			name:   "dependency fails",
+			checks: []Check{ok, failing, hanging},
+			code:   http.StatusServiceUnavailable,
+			statuses: map[string]string{
+				"ok":      response.StatusOK,
+				"failing": response.StatusError,
+				"hanging": response.StatusError,
+			},
+		},
+		{
+			name:   "optional dependency fails",
+			checks: []Check{ok, optional},
+			code:   http.StatusOK,
+			statuses: map[string]string{
+				"ok":       response.StatusOK,
+				"optional": response.StatusError,
+			},
+		},
+		{
+			name:     "shutting down",
+			checks:   []Check{ok},
+			shutdown: true,
+			code:     http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(10*time.Millisecond, tt.checks...)
+			if tt.shutdown {
+				h.Shutdown()
+			}
+
+			w := httptest.NewRecorder()
+			h.Ready(log).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			require.Equal(t, tt.code, w.Code)
+
+			var resp Response
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+			statuses := make(map[string]string)
+			for name, check := range resp.Checks {
+				statuses[name] = check.Status
+			}
+			if tt.statuses == nil {
+				tt.statuses = map[string]string{}
+			}
+			require.Equal(t, tt.statuses, statuses)
+		})
+	}
+}
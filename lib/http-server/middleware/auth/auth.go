@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/raisultan/url-shortener/lib/api/response"
+	"github.com/raisultan/url-shortener/lib/logger/sl"
+	"golang.org/x/exp/slog"
+)
+
+// ErrKeyNotFound is returned by resolvers for unknown keys.
+var ErrKeyNotFound = errors.New("api key not found")
+
+// Principal is the client an API key belongs to and the workspace it acts in.
+type Principal struct {
+	Name      string
+	Workspace string
+	// Admin may change links of any owner in the workspace.
+	Admin bool
+}
+
+// Owner returns the owner a link must have for the principal to change it,
+// empty for admins.
+func (p Principal) Owner() string {
+	if p.Admin {
+		return ""
+	}
+
+	return p.Name
+}
+
+// KeyResolver finds the principal of the API key by its hash.
+type KeyResolver interface {
+	ResolveKey(ctx context.Context, hash string) (Principal, error)
+}
+
+type ctxKey struct{}
+
+// New authenticates requests by the API key passed either as a bearer token
+// or in the X-API-Key header, and rejects requests without a known key.
+func New(log *slog.Logger, resolver KeyResolver) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		log := log.With(
+			slog.String("component", "middleware/auth"),
+		)
+
+		log.Info("auth middleware enabled")
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			key := apiKey(r)
+			if key == "" {
+				unauthorized(w, r, "missing api key")
+				return
+			}
+
+			principal, err := resolver.ResolveKey(r.Context(), HashKey(key))
+			if errors.Is(err, ErrKeyNotFound) {
+				log.Info("unknown api key", slog.String("request_id", middleware.GetReqID(r.Context())))
+				unauthorized(w, r, "invalid api key")
+				return
+			}
+			if err != nil {
+				log.Error("failed to resolve api key", sl.Err(err))
+				response.Problem(w, r, http.StatusInternalServerError, response.Error("failed to authenticate"))
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// HashKey returns the hex encoded sha256 of the key, the form keys are stored in.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal of an authenticated request.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(ctxKey{}).(Principal)
+
+	return principal, ok
+}
+
+func apiKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+
+	return ""
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, msg string) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	response.Problem(w, r, http.StatusUnauthorized, response.Error(msg))
+}
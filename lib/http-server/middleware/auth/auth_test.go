@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+type resolver map[string]Principal
+
+func (r resolver) ResolveKey(_ context.Context, hash string) (Principal, error) {
+	if hash == HashKey("broken") {
+		return Principal{}, errors.New("storage is down")
+	}
+
+	principal, ok := r[hash]
+	if !ok {
+		return Principal{}, ErrKeyNotFound
+	}
+
+	return principal, nil
+}
+
+func TestNew(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(httptest.NewRecorder(), nil))
+	keys := resolver{HashKey("secret"): {Name: "client", Workspace: "acme"}}
+
+	var got Principal
+	handler := New(log, keys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PrincipalFromContext(r.Context())
+	}))
+
+	cases := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{name: "missing key", want: http.StatusUnauthorized},
+		{name: "unknown key", header: "X-API-Key", value: "guess", want: http.StatusUnauthorized},
+		{name: "empty bearer token", header: "Authorization", value: "Bearer ", want: http.StatusUnauthorized},
+		{name: "failing resolver", header: "X-API-Key", value: "broken", want: http.StatusInternalServerError},
+		{name: "header key", header: "X-API-Key", value: "secret", want: http.StatusOK},
+		{name: "bearer token", header: "Authorization", value: "bearer secret", want: http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got = Principal{}
+
+			r := httptest.NewRequest(http.MethodDelete, "/abc", nil)
+			if tc.header != "" {
+				r.Header.Set(tc.header, tc.value)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			require.Equal(t, tc.want, w.Code)
+			if tc.want == http.StatusUnauthorized {
+				require.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+			}
+			if tc.want == http.StatusOK {
+				require.Equal(t, Principal{Name: "client", Workspace: "acme"}, got)
+			} else {
+				require.Equal(t, Principal{}, got, "rejected requests don't reach the handler")
+			}
+		})
+	}
+}
+
+func TestPrincipal_Owner(t *testing.T) {
+	require.Equal(t, "client", Principal{Name: "client"}.Owner())
+	require.Equal(t, "", Principal{Name: "ops", Admin: true}.Owner())
+}
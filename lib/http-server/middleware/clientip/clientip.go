@@ -0,0 +1,168 @@
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+type ctxKey struct{}
+
+// ParseTrustedProxies parses CIDRs and plain addresses of trusted proxies.
+func ParseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	const op = "clientip.ParseTrustedProxies"
+
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return prefixes, nil
+}
+
+// New resolves the address of the client a request came from. Forwarding
+// headers are believed only when the peer is a trusted proxy, and of the
+// addresses they list the client is the last one that is not a trusted proxy.
+// Forwarded takes precedence over X-Forwarded-For and X-Real-IP.
+func New(log *slog.Logger, trustedProxies []netip.Prefix) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		log := log.With(
+			slog.String("component", "middleware/clientip"),
+		)
+
+		log.Info("client ip middleware enabled", slog.Int("trusted_proxies", len(trustedProxies)))
+
+		trusted := func(addr netip.Addr) bool {
+			for _, prefix := range trustedProxies {
+				if prefix.Contains(addr) {
+					return true
+				}
+			}
+			return false
+		}
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ip := resolve(r, trusted)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, ip)))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// FromRequest returns the client address resolved by the middleware, or the
+// address of the peer without the port if the request didn't pass it.
+func FromRequest(r *http.Request) string {
+	if ip, ok := r.Context().Value(ctxKey{}).(string); ok {
+		return ip
+	}
+
+	return peer(r)
+}
+
+func resolve(r *http.Request, trusted func(netip.Addr) bool) string {
+	remote := peer(r)
+	addr, err := netip.ParseAddr(remote)
+	if err != nil || !trusted(addr.Unmap()) {
+		return remote
+	}
+
+	hops := forwardedFor(r.Header.Values("Forwarded"))
+	if len(hops) == 0 {
+		hops = xForwardedFor(r.Header.Values("X-Forwarded-For"))
+	}
+	if len(hops) == 0 {
+		if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+			return realIP.Unmap().String()
+		}
+		return remote
+	}
+
+	// hops are appended by every proxy, so the ones on the right are the
+	// most trustworthy
+	client := addr.Unmap()
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			// an obfuscated or unknown hop, nothing left of it can be trusted
+			break
+		}
+
+		client = hop.Unmap()
+		if !trusted(client) {
+			break
+		}
+	}
+
+	return client.String()
+}
+
+func peer(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// forwardedFor returns the for parameters of Forwarded headers (RFC 7239).
+func forwardedFor(headers []string) []string {
+	var hops []string
+	for _, header := range headers {
+		for _, element := range strings.Split(header, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(key, "for") {
+					continue
+				}
+				hops = append(hops, forwardedNode(value))
+			}
+		}
+	}
+
+	return hops
+}
+
+// forwardedNode strips the quotes, brackets and port of a node, as in
+// "[2001:db8::1]:4711".
+func forwardedNode(node string) string {
+	node = strings.Trim(node, `"`)
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return host
+	}
+
+	return strings.TrimSuffix(strings.TrimPrefix(node, "["), "]")
+}
+
+func xForwardedFor(headers []string) []string {
+	var hops []string
+	for _, header := range headers {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	return hops
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+func TestNew(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(httptest.NewRecorder(), nil))
+
+	router := chi.NewRouter()
+	router.Use(New(log, "test"))
+	router.Get("/{alias}", func(w http.ResponseWriter, r *http.Request) {
+		if chi.URLParam(r, "alias") == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	for _, path := range []string{"/a", "/b", "/missing", "/a/b"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	expected := `
+# HELP test_http_requests_total Number of handled HTTP requests.
+# TYPE test_http_requests_total counter
+test_http_requests_total{method="GET",route="/{alias}",status="200"} 2
+test_http_requests_total{method="GET",route="/{alias}",status="404"} 1
+test_http_requests_total{method="GET",route="unmatched",status="404"} 1
+`
+	require.NoError(t, testutil.GatherAndCompare(
+		prometheus.DefaultGatherer, strings.NewReader(expected), "test_http_requests_total",
+	))
+}
@@ -0,0 +1,158 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/raisultan/url-shortener/lib/api/response"
+	"github.com/raisultan/url-shortener/lib/http-server/middleware/auth"
+	"github.com/raisultan/url-shortener/lib/http-server/middleware/clientip"
+	"github.com/raisultan/url-shortener/lib/logger/sl"
+	"golang.org/x/exp/slog"
+)
+
+// Limit allows Rate requests per Period with bursts of up to Burst requests,
+// Burst defaults to Rate. Zero Rate means no limit.
+type Limit struct {
+	Rate   int
+	Period time.Duration
+	Burst  int
+}
+
+func (l Limit) IsZero() bool {
+	return l.Rate <= 0 || l.Period <= 0
+}
+
+// PerSecond returns the rate tokens are refilled with.
+func (l Limit) PerSecond() float64 {
+	return float64(l.Rate) / l.Period.Seconds()
+}
+
+func (l Limit) Capacity() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+
+	return l.Rate
+}
+
+// Rule limits requests to a route per API key and per client IP, requests
+// are rejected once either limit is exhausted.
+type Rule struct {
+	PerKey Limit
+	PerIP  Limit
+}
+
+// Result tells whether a request may proceed and, if not, how long until a
+// token is available.
+type Result struct {
+	Allowed    bool
+	RetryAfter time.Duration
+}
+
+// Limiter takes a token from the bucket stored under the key.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// New limits requests to the route, it has to run after the auth middleware
+// to limit requests per API key. Limits per client IP are better checked
+// before it, so requests with invalid keys are limited too. Routes without
+// limits are not wrapped.
+func New(log *slog.Logger, limiter Limiter, route string, rule Rule) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if rule.PerKey.IsZero() && rule.PerIP.IsZero() {
+			return next
+		}
+
+		log := log.With(
+			slog.String("component", "middleware/ratelimit"),
+			slog.String("route", route),
+		)
+
+		log.Info("rate limit middleware enabled")
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			for _, bucket := range buckets(r, route, rule) {
+				res, err := limiter.Allow(r.Context(), bucket.key, bucket.limit)
+				if err != nil {
+					// an unavailable limiter must not take the service down with it
+					log.Error("failed to check rate limit", sl.Err(err))
+					continue
+				}
+
+				if !res.Allowed {
+					log.Info("rate limit exceeded",
+						slog.String("bucket", bucket.key),
+						slog.String("request_id", middleware.GetReqID(r.Context())),
+					)
+					tooManyRequests(w, r, res.RetryAfter)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+type bucket struct {
+	key   string
+	limit Limit
+}
+
+func buckets(r *http.Request, route string, rule Rule) []bucket {
+	var res []bucket
+
+	if principal, ok := auth.PrincipalFromContext(r.Context()); ok && !rule.PerKey.IsZero() {
+		key := fmt.Sprintf("ratelimit:%s:key:%s/%s", route, principal.Workspace, principal.Name)
+		res = append(res, bucket{key: key, limit: rule.PerKey})
+	}
+
+	if !rule.PerIP.IsZero() {
+		key := fmt.Sprintf("ratelimit:%s:ip:%s", route, clientip.FromRequest(r))
+		res = append(res, bucket{key: key, limit: rule.PerIP})
+	}
+
+	return res
+}
+
+func tooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	response.Problem(w, r, http.StatusTooManyRequests, response.Error("rate limit exceeded"))
+}
+
+type fallback struct {
+	log      *slog.Logger
+	primary  Limiter
+	fallback Limiter
+}
+
+// WithFallback uses the fallback limiter while the primary one fails, so an
+// instance keeps limiting requests on its own when the shared store is down.
+func WithFallback(log *slog.Logger, primary Limiter, secondary Limiter) Limiter {
+	return &fallback{
+		log:      log.With(slog.String("component", "middleware/ratelimit")),
+		primary:  primary,
+		fallback: secondary,
+	}
+}
+
+func (f *fallback) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	res, err := f.primary.Allow(ctx, key, limit)
+	if err == nil {
+		return res, nil
+	}
+
+	f.log.Warn("rate limiter unavailable, falling back to local limits", sl.Err(err))
+
+	return f.fallback.Allow(ctx, key, limit)
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/raisultan/url-shortener/lib/http-server/middleware/auth"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	m := NewMemoryLimiter()
+	m.now = func() time.Time { return now }
+	limit := Limit{Rate: 2, Period: time.Second, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		res, err := m.Allow(ctx, "key", limit)
+		require.NoError(t, err)
+		require.True(t, res.Allowed, "request %d is within the burst", i)
+	}
+
+	res, err := m.Allow(ctx, "key", limit)
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+	require.Equal(t, 500*time.Millisecond, res.RetryAfter)
+
+	res, err = m.Allow(ctx, "other", limit)
+	require.NoError(t, err)
+	require.True(t, res.Allowed, "buckets are independent")
+
+	now = now.Add(500 * time.Millisecond)
+	res, err = m.Allow(ctx, "key", limit)
+	require.NoError(t, err)
+	require.True(t, res.Allowed, "a token is refilled")
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, string, Limit) (Result, error) {
+	return Result{}, errors.New("unavailable")
+}
+
+func TestNew(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(httptest.NewRecorder(), nil))
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	rule := Rule{
+		PerKey: Limit{Rate: 1, Period: time.Minute},
+		PerIP:  Limit{Rate: 2, Period: time.Minute},
+	}
+
+	tests := []struct {
+		name    string
+		limiter Limiter
+		want    []int
+	}{
+		{
+			name:    "limited",
+			limiter: NewMemoryLimiter(),
+			want:    []int{http.StatusOK, http.StatusTooManyRequests, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:    "fallback",
+			limiter: WithFallback(log, failingLimiter{}, NewMemoryLimiter()),
+			want:    []int{http.StatusOK, http.StatusTooManyRequests, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:    "limiter unavailable",
+			limiter: failingLimiter{},
+			want:    []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusOK},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := New(log, tt.limiter, "POST /url", rule)(ok)
+
+			// the second request of a key hits the key limit, the third
+			// key hits the limit of the IP all requests come from
+			principals := []string{"alice", "alice", "bob", "carol"}
+			for i, name := range principals {
+				r := httptest.NewRequest(http.MethodPost, "/url", nil)
+				r = r.WithContext(auth.WithPrincipal(r.Context(), auth.Principal{Name: name}))
+				w := httptest.NewRecorder()
+
+				handler.ServeHTTP(w, r)
+
+				require.Equal(t, tt.want[i], w.Code, "request %d", i)
+				if w.Code == http.StatusTooManyRequests {
+					require.NotEmpty(t, w.Header().Get("Retry-After"))
+				}
+			}
+		})
+	}
+}
+
+type noKeys struct{}
+
+func (noKeys) ResolveKey(context.Context, string) (auth.Principal, error) {
+	return auth.Principal{}, auth.ErrKeyNotFound
+}
+
+func TestNew_BeforeAuth(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(httptest.NewRecorder(), nil))
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	byIP := New(log, NewMemoryLimiter(), "POST /url", Rule{PerIP: Limit{Rate: 2, Period: time.Minute}})
+	handler := byIP(auth.New(log, noKeys{})(ok))
+
+	var got []int
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest(http.MethodPost, "/url", nil)
+		r.Header.Set("X-API-Key", "guess")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		got = append(got, w.Code)
+	}
+
+	require.Equal(t, []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}, got,
+		"guessing keys from one IP is limited")
+}
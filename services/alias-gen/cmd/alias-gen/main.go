@@ -2,20 +2,29 @@ package main
 
 import (
 	"context"
+	"errors"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/raisultan/url-shortener/lib/health"
 	middlewareLogger "github.com/raisultan/url-shortener/lib/http-server/middleware/logger"
+	middlewareMetrics "github.com/raisultan/url-shortener/lib/http-server/middleware/metrics"
+	middlewareTracing "github.com/raisultan/url-shortener/lib/http-server/middleware/tracing"
 	"github.com/raisultan/url-shortener/lib/logger"
 	"github.com/raisultan/url-shortener/lib/logger/sl"
+	"github.com/raisultan/url-shortener/lib/tracing"
 	"github.com/raisultan/url-shortener/services/alias-gen/internal/config"
+	"github.com/raisultan/url-shortener/services/alias-gen/internal/http-server/handlers/alias/batch"
 	"github.com/raisultan/url-shortener/services/alias-gen/internal/http-server/handlers/alias/generate"
+	"github.com/raisultan/url-shortener/services/alias-gen/internal/metrics"
 	"github.com/raisultan/url-shortener/services/alias-gen/internal/storage/postgres"
 	"golang.org/x/exp/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 func main() {
@@ -25,6 +34,17 @@ func main() {
 	log.Info("starting alias-generator", slog.String("env", cfg.Env))
 	log.Debug("debug messages are enabled")
 
+	shutdownTracing, err := tracing.Setup(context.Background(), "alias-gen", cfg.Tracing)
+	if err != nil {
+		log.Error("failed to initialize tracing", sl.Err(err))
+		os.Exit(1)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Error("failed to flush traces", sl.Err(err))
+		}
+	}()
+
 	storage, err := postgres.New(cfg.Postgres)
 	if err != nil {
 		log.Error("failed to initialize storage", sl.Err(err))
@@ -35,11 +55,21 @@ func main() {
 	router := chi.NewRouter()
 
 	router.Use(middleware.RequestID)
+	router.Use(middlewareTracing.New(log, "alias-gen"))
 	router.Use(middlewareLogger.New(log))
+	router.Use(middlewareMetrics.New(log, metrics.Namespace))
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.URLFormat)
 
 	router.Get("/alias", generate.New(log, storage))
+	router.Get("/aliases", batch.New(log, storage))
+	probes := health.New(
+		cfg.HttpServer.HealthTimeout,
+		health.Check{Name: "postgres", Ping: storage.Ping},
+	)
+
+	router.Get("/healthz", probes.Live())
+	router.Get("/readyz", probes.Ready(log))
 
 	log.Info("starting server", slog.String("address", cfg.HttpServer.Address))
 
@@ -60,18 +90,41 @@ func main() {
 		}
 	}()
 
+	metricsSrv := &http.Server{
+		Addr:        cfg.HttpServer.MetricsAddress,
+		Handler:     promhttp.Handler(),
+		ReadTimeout: cfg.HttpServer.Timeout,
+		IdleTimeout: cfg.HttpServer.IdleTimeout,
+	}
+
+	go func() {
+		if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("failed to start metrics server", sl.Err(err))
+		}
+	}()
+
 	log.Info("server started")
 
 	<-done
 
 	log.Info("stopping server")
 
+	probes.Shutdown()
+
+	// load balancers need a few probes to notice the instance is not ready,
+	// requests keep being served until they stop sending them
+	time.Sleep(cfg.HttpServer.ShutdownDelay)
+
 	ctx, cancel := context.WithTimeout(
 		context.Background(),
 		cfg.HttpServer.CtxTimeout,
 	)
 	defer cancel()
 
+	if err := metricsSrv.Shutdown(ctx); err != nil {
+		log.Error("failed to stop metrics server", sl.Err(err))
+	}
+
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Error("failed to stop server", sl.Err(err))
 
@@ -2,6 +2,7 @@ package config
 
 import (
 	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/raisultan/url-shortener/lib/tracing"
 	"log"
 	"os"
 	"time"
@@ -11,6 +12,7 @@ type Config struct {
 	Env        string `yaml:"env" env-default:"local"`
 	HttpServer `yaml:"http_server"`
 	Postgres   `yaml:"postgres"`
+	Tracing    tracing.Config `yaml:"tracing"`
 }
 
 type HttpServer struct {
@@ -18,6 +20,13 @@ type HttpServer struct {
 	Timeout     time.Duration `yaml:"timeout" env-default:"3s"`
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
 	CtxTimeout  time.Duration `yaml:"ctx_timeout" env-default:"8s"`
+	// ShutdownDelay keeps serving requests after readiness starts failing on
+	// shutdown, until load balancers take the instance out.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" env-default:"5s"`
+	// MetricsAddress serves Prometheus metrics apart from the API.
+	MetricsAddress string `yaml:"metrics_address" env-default:"localhost:9092"`
+	// HealthTimeout limits the storage check of the readiness probe.
+	HealthTimeout time.Duration `yaml:"health_timeout" env-default:"1s"`
 }
 
 type Postgres struct {
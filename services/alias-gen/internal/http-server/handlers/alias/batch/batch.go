@@ -0,0 +1,63 @@
+package batch
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/raisultan/url-shortener/lib/api/response"
+	"github.com/raisultan/url-shortener/lib/logger/sl"
+	"github.com/raisultan/url-shortener/services/alias-gen/internal/generator"
+	"golang.org/x/exp/slog"
+)
+
+const maxCount = 1000
+
+type Response struct {
+	response.Response
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+type CounterIncrementer interface {
+	IncrementCounterBy(n int64) (int64, error)
+}
+
+// New generates count aliases with a single counter increment.
+func New(log *slog.Logger, counterIncrementer CounterIncrementer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.alias.batch.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		count, err := strconv.ParseInt(r.URL.Query().Get("count"), 10, 64)
+		if err != nil || count < 1 || count > maxCount {
+			log.Info("invalid count", slog.String("count", r.URL.Query().Get("count")))
+			msg := fmt.Sprintf("count must be between 1 and %d", maxCount)
+			response.Problem(w, r, http.StatusBadRequest, response.Error(msg))
+			return
+		}
+
+		last, err := counterIncrementer.IncrementCounterBy(count)
+		if err != nil {
+			log.Error("failed to increment counter", sl.Err(err))
+			response.Problem(w, r, http.StatusInternalServerError, response.Error("failed to increment counter"))
+			return
+		}
+
+		aliases := make([]string, 0, count)
+		for n := last - count + 1; n <= last; n++ {
+			aliases = append(aliases, generator.GenerateAlias(n))
+		}
+
+		log.Info("aliases generated", slog.Int64("count", count))
+		render.JSON(w, r, Response{
+			Response: response.OK(),
+			Aliases:  aliases,
+		})
+	}
+}
@@ -31,7 +31,7 @@ func New(log *slog.Logger, counterIncrementer CounterIncrementer) http.HandlerFu
 		count, err := counterIncrementer.IncrementCounter()
 		if err != nil {
 			log.Error("failed to increment counter", sl.Err(err))
-			render.JSON(w, r, response.Error("failed to increment counter"))
+			response.Problem(w, r, http.StatusInternalServerError, response.Error("failed to increment counter"))
 			return
 		}
 
@@ -0,0 +1,17 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const Namespace = "alias_gen"
+
+// CounterIncrements counts values taken from the alias counter, one per
+// generated alias.
+var CounterIncrements = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: Namespace,
+	Subsystem: "counter",
+	Name:      "increments_total",
+	Help:      "Number of values taken from the alias counter.",
+})
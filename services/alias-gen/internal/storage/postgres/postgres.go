@@ -1,11 +1,13 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	_ "github.com/lib/pq"
 	"github.com/raisultan/url-shortener/lib/logger/sl"
 	"github.com/raisultan/url-shortener/services/alias-gen/internal/config"
+	"github.com/raisultan/url-shortener/services/alias-gen/internal/metrics"
 	"golang.org/x/exp/slog"
 )
 
@@ -51,6 +53,16 @@ func New(cfg config.Postgres) (*Storage, error) {
 	return &Storage{db}, nil
 }
 
+func (s *Storage) Ping(ctx context.Context) error {
+	const op = "storage.postgres.Ping"
+
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
 func (s *Storage) Close(log *slog.Logger) {
 	err := s.db.Close()
 	if err != nil {
@@ -73,5 +85,29 @@ func (s *Storage) IncrementCounter() (int64, error) {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
+	metrics.CounterIncrements.Inc()
+
+	return count, nil
+}
+
+// IncrementCounterBy reserves n values at once and returns the last one,
+// the reserved values are (last-n, last].
+func (s *Storage) IncrementCounterBy(n int64) (int64, error) {
+	const op = "storage.postgres.IncrementCounterBy"
+
+	var count int64
+	incrementStmt := `
+        UPDATE counter 
+        SET value = value + $1 
+        WHERE id = 1 
+        RETURNING value;
+    `
+	err := s.db.QueryRow(incrementStmt, n).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	metrics.CounterIncrements.Add(float64(n))
+
 	return count, nil
 }
@@ -2,41 +2,91 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/raisultan/url-shortener/lib/health"
+	"github.com/raisultan/url-shortener/lib/http-server/middleware/auth"
+	middlewareClientIP "github.com/raisultan/url-shortener/lib/http-server/middleware/clientip"
 	middlewareLogger "github.com/raisultan/url-shortener/lib/http-server/middleware/logger"
+	middlewareMetrics "github.com/raisultan/url-shortener/lib/http-server/middleware/metrics"
+	"github.com/raisultan/url-shortener/lib/http-server/middleware/ratelimit"
+	middlewareTracing "github.com/raisultan/url-shortener/lib/http-server/middleware/tracing"
 	"github.com/raisultan/url-shortener/lib/logger"
 	"github.com/raisultan/url-shortener/lib/logger/sl"
+	"github.com/raisultan/url-shortener/lib/tracing"
 	"github.com/raisultan/url-shortener/services/main/internal/alias"
 	"github.com/raisultan/url-shortener/services/main/internal/analytics/clickhouse"
+	"github.com/raisultan/url-shortener/services/main/internal/analytics/geoip"
+	"github.com/raisultan/url-shortener/services/main/internal/analytics/jsonl"
+	"github.com/raisultan/url-shortener/services/main/internal/analytics/privacy"
+	"github.com/raisultan/url-shortener/services/main/internal/analytics/sinks"
+	"github.com/raisultan/url-shortener/services/main/internal/analytics/webhook"
+	"github.com/raisultan/url-shortener/services/main/internal/apikey"
 	"github.com/raisultan/url-shortener/services/main/internal/cache/redis"
 	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"github.com/raisultan/url-shortener/services/main/internal/domain"
+	domainDelete "github.com/raisultan/url-shortener/services/main/internal/http-server/handlers/domain/delete"
+	domainList "github.com/raisultan/url-shortener/services/main/internal/http-server/handlers/domain/list"
+	domainSave "github.com/raisultan/url-shortener/services/main/internal/http-server/handlers/domain/save"
+	"github.com/raisultan/url-shortener/services/main/internal/http-server/handlers/url/batch"
 	"github.com/raisultan/url-shortener/services/main/internal/http-server/handlers/url/delete"
+	"github.com/raisultan/url-shortener/services/main/internal/http-server/handlers/url/history"
+	"github.com/raisultan/url-shortener/services/main/internal/http-server/handlers/url/list"
 	"github.com/raisultan/url-shortener/services/main/internal/http-server/handlers/url/redirect"
 	"github.com/raisultan/url-shortener/services/main/internal/http-server/handlers/url/save"
+	"github.com/raisultan/url-shortener/services/main/internal/http-server/handlers/url/stats"
+	"github.com/raisultan/url-shortener/services/main/internal/http-server/handlers/url/update"
+	"github.com/raisultan/url-shortener/services/main/internal/metrics"
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+	"github.com/raisultan/url-shortener/services/main/internal/storage/memory"
+	"github.com/raisultan/url-shortener/services/main/internal/storage/metered"
 	"github.com/raisultan/url-shortener/services/main/internal/storage/mongo"
+	"github.com/raisultan/url-shortener/services/main/internal/storage/postgres"
 	"github.com/raisultan/url-shortener/services/main/internal/storage/sqlite"
+	"github.com/raisultan/url-shortener/services/main/internal/workspace"
 	"golang.org/x/exp/slog"
 )
 
 type Storage interface {
+	Ping(_ context.Context) error
 	Close(_ context.Context, log *slog.Logger)
-	SaveUrl(
-		_ context.Context,
-		urlToSave string,
-		alias string,
-	) error
-	GetUrl(_ context.Context, alias string) (string, error)
-	DeleteUrl(_ context.Context, alias string) error
+	SaveUrl(_ context.Context, link storage.Link) error
+	SaveUrls(_ context.Context, links []storage.Link) ([]error, error)
+	GetUrl(_ context.Context, workspace string, alias string) (storage.Link, error)
+	DeleteUrl(_ context.Context, workspace string, alias string, owner string) error
+	UpdateUrl(_ context.Context, workspace string, alias string, url string, owner string) (storage.Link, error)
+	GetUrlHistory(_ context.Context, workspace string, alias string) ([]storage.HistoryEntry, error)
+	ListUrls(_ context.Context, filter storage.ListFilter) (storage.LinkPage, error)
+	SaveAPIKey(_ context.Context, key storage.APIKey) error
+	GetAPIKey(_ context.Context, hash string) (storage.APIKey, error)
+	SaveWorkspace(_ context.Context, ws storage.Workspace) error
+	GetWorkspace(_ context.Context, id string) (storage.Workspace, error)
+	ReserveLinks(_ context.Context, workspace string, n int) error
+	ReleaseLinks(_ context.Context, workspace string, n int) error
+	SaveDomain(_ context.Context, domain storage.Domain) error
+	GetDomain(_ context.Context, host string) (storage.Domain, error)
+	ListDomains(_ context.Context, workspace string) ([]storage.Domain, error)
+	DeleteDomain(_ context.Context, workspace string, host string) error
 }
 
 func main() {
+	createAPIKey := flag.String("create-api-key", "", "create an API key for the named client, print it and exit")
+	keyWorkspace := flag.String("workspace", storage.DefaultWorkspace, "workspace of the created API key")
+	createWorkspace := flag.String("create-workspace", "", "create a workspace with the given id and exit")
+	linkQuota := flag.Int("link-quota", 0, "number of links the created workspace may create, 0 for no limit")
+	workspaceDomain := flag.String("domain", "", "host to bind to the created workspace")
+	flag.Parse()
+
 	cfg := config.MustLoadConfig()
 	log := logger.SetupLogger(cfg.Env)
 
@@ -54,8 +104,42 @@ func main() {
 		log.Error("failed to initialize storage", sl.Err(err))
 		os.Exit(1)
 	}
+	storage = metered.New(storage)
 	defer storage.Close(ctx, log)
 
+	if *createWorkspace != "" {
+		err := workspace.Create(ctx, storage, *createWorkspace, *linkQuota, *workspaceDomain)
+		if err != nil {
+			log.Error("failed to create workspace", sl.Err(err))
+			os.Exit(1)
+		}
+
+		log.Info("workspace created", slog.String("workspace", *createWorkspace))
+		return
+	}
+
+	if *createAPIKey != "" {
+		key, err := apikey.Create(ctx, storage, *createAPIKey, *keyWorkspace)
+		if err != nil {
+			log.Error("failed to create api key", sl.Err(err))
+			os.Exit(1)
+		}
+
+		fmt.Println(key)
+		return
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx, "url-shortener", cfg.Tracing)
+	if err != nil {
+		log.Error("failed to initialize tracing", sl.Err(err))
+		os.Exit(1)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Error("failed to flush traces", sl.Err(err))
+		}
+	}()
+
 	cache, err := redis.New(cfg.Cache, ctx)
 	if err != nil {
 		log.Error("failed to initialize cache", sl.Err(err))
@@ -63,24 +147,123 @@ func main() {
 	}
 	defer cache.Close(log)
 
+	trustedProxies, err := middlewareClientIP.ParseTrustedProxies(cfg.HttpServer.TrustedProxies)
+	if err != nil {
+		log.Error("invalid trusted proxies", sl.Err(err))
+		os.Exit(1)
+	}
+
 	router := chi.NewRouter()
 
 	router.Use(middleware.RequestID)
+	router.Use(middlewareClientIP.New(log, trustedProxies))
+	router.Use(middlewareTracing.New(log, "url-shortener"))
 	router.Use(middlewareLogger.New(log))
+	router.Use(middlewareMetrics.New(log, metrics.Namespace))
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.URLFormat)
 
 	agc := alias.NewAliasGeneratorClient(cfg.AliasGenerator)
-	analyticsTracker, err := clickhouse.NewClickHouseAnalyticsTracker(cfg.ClickHouse)
+
+	clicks := sinks.New(log, cfg.Analytics)
+	var analyticsTracker *clickhouse.AnalyticsTracker
+	for _, name := range cfg.Analytics.Sinks {
+		sink, err := newAnalyticsSink(log, cfg, name)
+		if err != nil {
+			log.Error("failed to initialize analytics sink", slog.String("sink", name), sl.Err(err))
+			os.Exit(1)
+		}
+
+		if tracker, ok := sink.(*clickhouse.AnalyticsTracker); ok {
+			analyticsTracker = tracker
+		}
+
+		if err := clicks.Add(name, sink); err != nil {
+			log.Error("failed to initialize analytics sink", slog.String("sink", name), sl.Err(err))
+			os.Exit(1)
+		}
+	}
+
+	anonymized, err := privacy.New(log, cfg.Analytics.Privacy, clicks)
 	if err != nil {
-		log.Error("failed to initialize analytics storage", sl.Err(err))
+		log.Error("failed to initialize analytics privacy", sl.Err(err))
 		os.Exit(1)
 	}
-	defer analyticsTracker.Close(log)
 
-	router.Post("/url", save.New(log, storage, cache, agc))
-	router.Get("/{alias}", redirect.New(log, storage, cache, analyticsTracker))
-	router.Delete("/{alias}", delete.New(log, storage, cache))
+	// clicks are located by the IP before it is anonymized
+	var clickTracker redirect.AnalyticsTracker = anonymized
+	if len(cfg.Analytics.GeoIP.Databases) > 0 {
+		located, err := geoip.New(log, cfg.Analytics.GeoIP, anonymized)
+		if err != nil {
+			log.Error("failed to initialize geoip", sl.Err(err))
+			os.Exit(1)
+		}
+		defer located.Close()
+
+		clickTracker = located
+	}
+
+	domains := domain.NewResolver(domain.NewCachedDomains(storage, cache), cfg.HttpServer.DefaultDomain)
+	linkCache := domain.NewCache(cache, domains)
+
+	limiter := ratelimit.WithFallback(log, cache, ratelimit.NewMemoryLimiter())
+	rateLimit := func(route string) func(http.Handler) http.Handler {
+		limits := cfg.RateLimit.Routes[route]
+		rule := ratelimit.Rule{
+			PerKey: ratelimit.Limit(limits.PerKey),
+			PerIP:  ratelimit.Limit(limits.PerIP),
+		}
+
+		return ratelimit.New(log, limiter, route, rule)
+	}
+
+	checks := []health.Check{
+		{Name: "storage", Ping: storage.Ping},
+		{Name: "redis", Ping: cache.Ping},
+		{Name: "alias-gen", Ping: agc.Ping},
+	}
+	if analyticsTracker != nil {
+		checks = append(checks, health.Check{
+			Name:     "clickhouse",
+			Ping:     analyticsTracker.Ping,
+			Optional: cfg.ClickHouse.TolerateUnavailable,
+		})
+	}
+	probes := health.New(cfg.HttpServer.HealthTimeout, checks...)
+
+	router.Get("/healthz", probes.Live())
+	router.Get("/readyz", probes.Ready(log))
+	redirectHandler := redirect.New(log, storage, linkCache, domains, clickTracker)
+	router.With(rateLimit("GET /{alias}")).Get("/{alias}", redirectHandler)
+	// link unfurlers check links with HEAD requests, they are tracked as bots
+	router.With(rateLimit("GET /{alias}")).Head("/{alias}", redirectHandler)
+
+	authenticate := auth.New(log, apikey.NewResolver(storage, cfg.Auth.Admins))
+	// requests are limited per client IP before they are authenticated, so
+	// guessing API keys is limited as well, and per API key after
+	authenticated := func(route string) chi.Router {
+		limits := cfg.RateLimit.Routes[route]
+
+		return router.With(
+			ratelimit.New(log, limiter, route, ratelimit.Rule{PerIP: ratelimit.Limit(limits.PerIP)}),
+			authenticate,
+			ratelimit.New(log, limiter, route, ratelimit.Rule{PerKey: ratelimit.Limit(limits.PerKey)}),
+		)
+	}
+
+	authenticated("GET /urls").Get("/urls", list.New(log, storage))
+	authenticated("GET /{alias}/history").Get("/{alias}/history", history.New(log, storage))
+	if analyticsTracker != nil {
+		authenticated("GET /{alias}/stats").Get("/{alias}/stats", stats.New(log, storage, analyticsTracker))
+	}
+	authenticated("POST /url").Post("/url", save.New(log, storage, linkCache, storage, agc))
+	authenticated("POST /urls/batch").Post("/urls/batch", batch.New(log, storage, linkCache, storage, agc))
+	authenticated("DELETE /{alias}").Delete("/{alias}", delete.New(log, storage, linkCache))
+	authenticated("PATCH /{alias}").Patch("/{alias}", update.New(log, storage, linkCache))
+
+	authenticated("GET /domains").Get("/domains", domainList.New(log, storage))
+	authenticated("POST /domains").Post("/domains", domainSave.New(log, storage, linkCache))
+	authenticated("DELETE /domains/{host}").Delete("/domains/{host}", domainDelete.New(log, storage, linkCache))
 
 	log.Info("starting server", slog.String("address", cfg.HttpServer.Address))
 
@@ -101,16 +284,49 @@ func main() {
 		}
 	}()
 
+	metricsSrv := &http.Server{
+		Addr:        cfg.HttpServer.MetricsAddress,
+		Handler:     promhttp.Handler(),
+		ReadTimeout: cfg.HttpServer.Timeout,
+		IdleTimeout: cfg.HttpServer.IdleTimeout,
+	}
+
+	go func() {
+		if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("failed to start metrics server", sl.Err(err))
+		}
+	}()
+
 	log.Info("server started")
 
 	<-done
 
 	log.Info("stopping server")
 
-	if err := srv.Shutdown(ctx); err != nil {
+	probes.Shutdown()
+
+	// load balancers need a few probes to notice the instance is not ready,
+	// requests keep being served until they stop sending them
+	time.Sleep(cfg.HttpServer.ShutdownDelay)
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(
+		context.Background(),
+		cfg.HttpServer.CtxTimeout,
+	)
+	defer cancelShutdown()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Error("failed to stop server", sl.Err(err))
+	}
 
-		return
+	if err := metricsSrv.Shutdown(shutdownCtx); err != nil {
+		log.Error("failed to stop metrics server", sl.Err(err))
+	}
+
+	// redirects in flight are done, what they queued is flushed before the
+	// sinks are closed
+	if err := clicks.Close(shutdownCtx); err != nil {
+		log.Error("failed to flush click events", sl.Err(err))
 	}
 
 	log.Info("server stopped")
@@ -128,7 +344,32 @@ func newStorage(cfg *config.Config, ctx context.Context) (Storage, error) {
 			cfg.Storages,
 			ctx,
 		)
+	case "postgres":
+		return postgres.New(
+			cfg.Storages,
+			ctx,
+		)
+	case "memory":
+		return memory.New(
+			cfg.Storages,
+			ctx,
+		)
 	default:
 		return nil, fmt.Errorf("unsupported storage type: %s", cfg.ActiveStorage)
 	}
 }
+
+func newAnalyticsSink(log *slog.Logger, cfg *config.Config, name string) (sinks.Sink, error) {
+	switch name {
+	case sinks.ClickHouse:
+		return clickhouse.NewClickHouseAnalyticsTracker(log, cfg.ClickHouse)
+	case sinks.File:
+		return jsonl.NewFile(cfg.Analytics.File.Path)
+	case sinks.Stdout:
+		return jsonl.New(os.Stdout), nil
+	case sinks.Webhook:
+		return webhook.New(cfg.Analytics.Webhook), nil
+	default:
+		return nil, fmt.Errorf("unsupported analytics sink: %s", name)
+	}
+}
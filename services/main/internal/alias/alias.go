@@ -1,9 +1,13 @@
 package alias
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"net/http"
 )
 
@@ -13,6 +17,12 @@ type Response struct {
 	Error  string `json:"error,omitempty"`
 }
 
+type BatchResponse struct {
+	Status  string   `json:"status"`
+	Aliases []string `json:"aliases"`
+	Error   string   `json:"error,omitempty"`
+}
+
 type Client struct {
 	baseURL string
 	client  *http.Client
@@ -21,12 +31,25 @@ type Client struct {
 func NewAliasGeneratorClient(cfg config.AliasGenerator) *Client {
 	return &Client{
 		baseURL: cfg.Address,
-		client:  &http.Client{Timeout: cfg.Timeout},
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+	}
+}
+
+// GenerateAlias gets an alias that is not reserved.
+func (agc *Client) GenerateAlias(ctx context.Context) (string, error) {
+	for {
+		alias, err := agc.generateAlias(ctx)
+		if err != nil || !storage.IsReservedAlias(alias) {
+			return alias, err
+		}
 	}
 }
 
-func (agc *Client) GenerateAlias() (string, error) {
-	resp, err := agc.client.Get(agc.baseURL + "/alias")
+func (agc *Client) generateAlias(ctx context.Context) (string, error) {
+	resp, err := agc.get(ctx, agc.baseURL+"/alias")
 	if err != nil {
 		return "", err
 	}
@@ -44,3 +67,72 @@ func (agc *Client) GenerateAlias() (string, error) {
 
 	return aliasResp.Alias, nil
 }
+
+// GenerateAliases gets count aliases that are not reserved, in a single round
+// trip unless some are.
+func (agc *Client) GenerateAliases(ctx context.Context, count int) ([]string, error) {
+	aliases := make([]string, 0, count)
+	for len(aliases) < count {
+		generated, err := agc.generateAliases(ctx, count-len(aliases))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, alias := range generated {
+			if !storage.IsReservedAlias(alias) {
+				aliases = append(aliases, alias)
+			}
+		}
+	}
+
+	return aliases, nil
+}
+
+func (agc *Client) generateAliases(ctx context.Context, count int) ([]string, error) {
+	resp, err := agc.get(ctx, fmt.Sprintf("%s/aliases?count=%d", agc.baseURL, count))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var aliasResp BatchResponse
+	err = json.NewDecoder(resp.Body).Decode(&aliasResp)
+	if err != nil {
+		return nil, err
+	}
+
+	if aliasResp.Status == "Error" {
+		return nil, errors.New(aliasResp.Error)
+	}
+
+	if len(aliasResp.Aliases) != count {
+		return nil, fmt.Errorf("expected %d aliases, got %d", count, len(aliasResp.Aliases))
+	}
+
+	return aliasResp.Aliases, nil
+}
+
+// get sends the request within the trace of ctx, so alias-gen continues it.
+func (agc *Client) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return agc.client.Do(req)
+}
+
+// Ping checks that alias-gen is alive.
+func (agc *Client) Ping(ctx context.Context) error {
+	resp, err := agc.get(ctx, agc.baseURL+"/healthz")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
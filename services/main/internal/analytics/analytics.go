@@ -1,13 +1,60 @@
 package analytics
 
-import "time"
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/raisultan/url-shortener/lib/http-server/middleware/clientip"
+	"github.com/raisultan/url-shortener/services/main/internal/analytics/bots"
+	"github.com/raisultan/url-shortener/services/main/internal/analytics/useragent"
+)
+
+// ErrRejected marks click events a sink refuses to take, inserting them again
+// fails the same way.
+var ErrRejected = errors.New("click events rejected")
 
 type ClickEvent struct {
-	URLAlias  string
-	Timestamp time.Time
-	UserAgent string
-	IP        string
-	Referrer  string
-	Latency   time.Duration
-	Error     string
+	Workspace string    `json:"workspace"`
+	URLAlias  string    `json:"url_alias"`
+	Timestamp time.Time `json:"timestamp"`
+	UserAgent string    `json:"user_agent"`
+	// Device, OS and Browser are parsed from UserAgent.
+	Device         string        `json:"device,omitempty"`
+	OS             string        `json:"os,omitempty"`
+	OSVersion      string        `json:"os_version,omitempty"`
+	Browser        string        `json:"browser,omitempty"`
+	BrowserVersion string        `json:"browser_version,omitempty"`
+	Bot            bool          `json:"bot,omitempty"`
+	IP             string        `json:"ip"`
+	VisitorID      string        `json:"visitor_id,omitempty"`
+	Country        string        `json:"country,omitempty"`
+	Region         string        `json:"region,omitempty"`
+	City           string        `json:"city,omitempty"`
+	ASN            uint32        `json:"asn,omitempty"`
+	ASOrg          string        `json:"as_org,omitempty"`
+	Referrer       string        `json:"referrer"`
+	Latency        time.Duration `json:"latency"`
+	Error          string        `json:"error,omitempty"`
+}
+
+// NewClickEvent describes the redirect request r took.
+func NewClickEvent(r *http.Request, alias string, latency time.Duration, errMessage string) ClickEvent {
+	client := useragent.Parse(r.UserAgent())
+
+	return ClickEvent{
+		URLAlias:       alias,
+		Timestamp:      time.Now(),
+		UserAgent:      r.UserAgent(),
+		Device:         client.Device,
+		OS:             client.OS,
+		OSVersion:      client.OSVersion,
+		Browser:        client.Browser,
+		BrowserVersion: client.BrowserVersion,
+		Bot:            bots.IsBot(r, client.Device == useragent.DeviceBot),
+		IP:             clientip.FromRequest(r),
+		Referrer:       r.Referer(),
+		Latency:        latency,
+		Error:          errMessage,
+	}
 }
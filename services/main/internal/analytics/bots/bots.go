@@ -0,0 +1,72 @@
+// Package bots tells clicks of bots, link unfurlers and security scanners from
+// clicks of people.
+package bots
+
+import (
+	"net/http"
+	"strings"
+)
+
+// signatures are lowercase fragments of user agents of bots that don't call
+// themselves bots, crawlers or spiders.
+var signatures = []string{
+	"slackbot",
+	"twitterbot",
+	"facebookexternalhit",
+	"facebookcatalog",
+	"linkedinbot",
+	"discordbot",
+	"telegrambot",
+	"whatsapp",
+	"skypeuripreview",
+	"applebot",
+	"pinterest",
+	"redditbot",
+	"embedly",
+	"iframely",
+	"vkshare",
+	"mattermost",
+	"google-safety",
+	"urlscan",
+	"virustotal",
+	"headlesschrome",
+	"phantomjs",
+	"python-requests",
+	"python-urllib",
+	"go-http-client",
+	"curl/",
+	"wget/",
+}
+
+// prefetchHeaders mark requests browsers and apps make ahead of a click, to
+// prefetch or preview the link.
+var prefetchHeaders = []string{"Purpose", "Sec-Purpose", "X-Purpose", "X-Moz"}
+
+// IsBot reports whether r was made by a bot. userAgentBot is whether the user
+// agent was parsed as one.
+func IsBot(r *http.Request, userAgentBot bool) bool {
+	if userAgentBot || r.Method == http.MethodHead {
+		return true
+	}
+
+	for _, header := range prefetchHeaders {
+		value := strings.ToLower(r.Header.Get(header))
+		if strings.Contains(value, "prefetch") || strings.Contains(value, "preview") {
+			return true
+		}
+	}
+
+	return knownBot(r.UserAgent())
+}
+
+// knownBot reports whether ua is of a known bot.
+func knownBot(ua string) bool {
+	ua = strings.ToLower(ua)
+	for _, signature := range signatures {
+		if strings.Contains(ua, signature) {
+			return true
+		}
+	}
+
+	return false
+}
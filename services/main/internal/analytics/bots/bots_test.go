@@ -0,0 +1,56 @@
+package bots
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const browser = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36"
+
+func TestIsBot(t *testing.T) {
+	cases := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    bool
+	}{
+		{name: "browser", headers: map[string]string{"User-Agent": browser}},
+		{
+			name:    "unfurler",
+			headers: map[string]string{"User-Agent": "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"},
+			want:    true,
+		},
+		{
+			name:    "whatsapp",
+			headers: map[string]string{"User-Agent": "WhatsApp/2.23.20.0"},
+			want:    true,
+		},
+		{
+			name:    "head request",
+			method:  http.MethodHead,
+			headers: map[string]string{"User-Agent": browser},
+			want:    true,
+		},
+		{
+			name:    "prefetch",
+			headers: map[string]string{"User-Agent": browser, "Sec-Purpose": "prefetch;prerender"},
+			want:    true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, "/abc", nil)
+			for key, value := range tc.headers {
+				r.Header.Set(key, value)
+			}
+
+			require.Equal(t, tc.want, IsBot(r, false))
+		})
+	}
+
+	require.True(t, IsBot(httptest.NewRequest(http.MethodGet, "/abc", nil), true))
+}
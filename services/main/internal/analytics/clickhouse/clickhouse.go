@@ -1,34 +1,93 @@
 package clickhouse
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"net/http"
-	"time"
+	"slices"
+	"sync/atomic"
 
-	_ "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/raisultan/url-shortener/lib/logger/sl"
 	"github.com/raisultan/url-shortener/services/main/internal/analytics"
 	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/exp/slog"
 )
 
+var tracer = otel.Tracer("github.com/raisultan/url-shortener/services/main/internal/analytics/clickhouse")
+
+// addedColumns are added to clicks tables created before them. Clicks that
+// predate workspaces belong to the default one.
+var addedColumns = []string{
+	"workspace String DEFAULT 'default'",
+	"visitor_id String DEFAULT ''",
+	"country LowCardinality(String) DEFAULT ''",
+	"region LowCardinality(String) DEFAULT ''",
+	"city String DEFAULT ''",
+	"asn UInt32 DEFAULT 0",
+	"as_org String DEFAULT ''",
+	"device LowCardinality(String) DEFAULT ''",
+	"os LowCardinality(String) DEFAULT ''",
+	"os_version LowCardinality(String) DEFAULT ''",
+	"browser LowCardinality(String) DEFAULT ''",
+	"browser_version LowCardinality(String) DEFAULT ''",
+	"bot Bool DEFAULT false",
+}
+
+// visitor identifies the visitor of a click, clicks recorded before visitor
+// hashes fall back to their IP without the port. Ports are only stripped off
+// "[v6]:port" and "v4:port", the last group of a bare IPv6 address looks
+// like one.
+const visitor = `if(visitor_id != '', visitor_id, replaceRegexpOne(replaceRegexpOne(ip, '^\\[(.+)\\]:[0-9]+$', '\\1'), '^([0-9.]+):[0-9]+$', '\\1'))`
+
 type AnalyticsTracker struct {
 	db     *sql.DB
 	dbName string
+	// tableCreated is set once the clicks table is known to exist.
+	tableCreated atomic.Bool
 }
 
-func NewClickHouseAnalyticsTracker(cfg config.ClickHouse) (*AnalyticsTracker, error) {
+// NewClickHouseAnalyticsTracker connects to ClickHouse and creates the clicks
+// table. With cfg.TolerateUnavailable an unavailable ClickHouse is not an
+// error, the table is created on the first insert instead.
+func NewClickHouseAnalyticsTracker(log *slog.Logger, cfg config.ClickHouse) (*AnalyticsTracker, error) {
 	conn, err := sql.Open("clickhouse", cfg.Dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to ClickHouse: %w", err)
 	}
 
-	if err := conn.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping ClickHouse: %w", err)
+	tracker := &AnalyticsTracker{db: conn, dbName: cfg.Database}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.StartTimeout)
+	defer cancel()
+
+	if err := tracker.createTable(ctx); err != nil {
+		if !cfg.TolerateUnavailable {
+			_ = conn.Close()
+			return nil, err
+		}
+
+		log.Warn("ClickHouse is unavailable, starting without it", sl.Err(err))
+	}
+
+	return tracker, nil
+}
+
+func (tracker *AnalyticsTracker) createTable(ctx context.Context) error {
+	if tracker.tableCreated.Load() {
+		return nil
+	}
+
+	if err := tracker.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping ClickHouse: %w", err)
 	}
 
-	dbName := cfg.Database
 	createTableIfNotExistsQuery := fmt.Sprintf(`
 		CREATE TABLE IF NOT EXISTS %s.clicks (
 			url_alias String,
@@ -40,12 +99,29 @@ func NewClickHouseAnalyticsTracker(cfg config.ClickHouse) (*AnalyticsTracker, er
 			error String
 		) ENGINE = MergeTree()
 		ORDER BY timestamp
-	`, dbName)
-	if _, err := conn.Exec(createTableIfNotExistsQuery); err != nil {
-		return nil, fmt.Errorf("failed to create table: %w", err)
+	`, tracker.dbName)
+	if _, err := tracker.db.ExecContext(ctx, createTableIfNotExistsQuery); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	for _, column := range addedColumns {
+		query := fmt.Sprintf("ALTER TABLE %s.clicks ADD COLUMN IF NOT EXISTS %s", tracker.dbName, column)
+		if _, err := tracker.db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to add column: %w", err)
+		}
 	}
 
-	return &AnalyticsTracker{db: conn, dbName: dbName}, nil
+	tracker.tableCreated.Store(true)
+
+	return nil
+}
+
+func (tracker *AnalyticsTracker) Ping(ctx context.Context) error {
+	if err := tracker.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping ClickHouse: %w", err)
+	}
+
+	return nil
 }
 
 func (tracker *AnalyticsTracker) Close(log *slog.Logger) {
@@ -55,47 +131,277 @@ func (tracker *AnalyticsTracker) Close(log *slog.Logger) {
 	}
 }
 
-func (tracker *AnalyticsTracker) TrackClickEvent(
-	r *http.Request,
-	alias string,
-	latency time.Duration,
-	errMessage string,
-) error {
-	event := analytics.ClickEvent{
-		URLAlias:  alias,
-		Timestamp: time.Now(),
-		UserAgent: r.UserAgent(),
-		IP:        r.RemoteAddr,
-		Referrer:  r.Referer(),
-		Latency:   latency,
-		Error:     errMessage,
+// InsertClickEvents writes events with a single INSERT, ClickHouse handles
+// a few large inserts far better than many small ones.
+func (tracker *AnalyticsTracker) InsertClickEvents(ctx context.Context, events []analytics.ClickEvent) (err error) {
+	ctx, span := tracer.Start(ctx, "clickhouse.InsertClickEvents",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemClickhouse,
+			semconv.DBOperation("INSERT"),
+			attribute.Int("events", len(events)),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	if err := tracker.createTable(ctx); err != nil {
+		return err
 	}
 
 	query := fmt.Sprintf(`
 		INSERT INTO %s.clicks (
+			workspace,
 			url_alias,
 			timestamp,
 			user_agent,
+			device,
+			os,
+			os_version,
+			browser,
+			browser_version,
+			bot,
 			ip,
+			visitor_id,
+			country,
+			region,
+			city,
+			asn,
+			as_org,
 			referrer,
 			latency,
 			error
-		) VALUES (?, ?, ?, ?, ?, ?, ?)
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`, tracker.dbName)
 
-	_, err := tracker.db.Exec(
-		query,
-		event.URLAlias,
-		event.Timestamp,
-		event.UserAgent,
-		event.IP,
-		event.Referrer,
-		event.Latency.Milliseconds(),
-		event.Error,
-	)
+	// the driver sends the rows prepared within a transaction as one block
+	tx, err := tracker.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin click events batch: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
-		return fmt.Errorf("failed to insert click event: %w", err)
+		return fmt.Errorf("failed to prepare click events batch: %w", err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	for _, event := range events {
+		_, err := stmt.ExecContext(
+			ctx,
+			event.Workspace,
+			event.URLAlias,
+			event.Timestamp,
+			event.UserAgent,
+			event.Device,
+			event.OS,
+			event.OSVersion,
+			event.Browser,
+			event.BrowserVersion,
+			event.Bot,
+			event.IP,
+			event.VisitorID,
+			event.Country,
+			event.Region,
+			event.City,
+			event.ASN,
+			event.ASOrg,
+			event.Referrer,
+			event.Latency.Milliseconds(),
+			event.Error,
+		)
+		// rows are appended to the block locally, values the columns can't
+		// take fail here
+		if err != nil && ctx.Err() == nil {
+			return fmt.Errorf("failed to append click event: %w: %w", analytics.ErrRejected, err)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to append click event: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to insert click events: %w", rejected(err))
 	}
 
 	return nil
 }
+
+// dataErrors are codes of exceptions ClickHouse throws for data it can't
+// parse or convert, inserting the same data again fails the same way.
+var dataErrors = []int32{
+	6,   // CANNOT_PARSE_TEXT
+	27,  // CANNOT_PARSE_INPUT_ASSERTION_FAILED
+	38,  // CANNOT_PARSE_DATE
+	41,  // CANNOT_PARSE_DATETIME
+	53,  // TYPE_MISMATCH
+	69,  // ARGUMENT_OUT_OF_BOUND
+	70,  // CANNOT_CONVERT_TYPE
+	117, // INCORRECT_DATA
+}
+
+// rejected marks exceptions thrown for the inserted data with
+// analytics.ErrRejected, other errors may go away on their own.
+func rejected(err error) error {
+	var exception *clickhouse.Exception
+	if errors.As(err, &exception) && slices.Contains(dataErrors, exception.Code) {
+		return fmt.Errorf("%w: %w", analytics.ErrRejected, err)
+	}
+
+	return err
+}
+
+// GetClickStats aggregates the clicks of an alias. Visitor hashes rotate
+// daily, so a visitor coming back on another day is counted again.
+func (tracker *AnalyticsTracker) GetClickStats(ctx context.Context, filter analytics.StatsFilter) (stats analytics.Stats, err error) {
+	const op = "analytics.clickhouse.GetClickStats"
+
+	ctx, span := tracer.Start(ctx, "clickhouse.GetClickStats",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemClickhouse,
+			semconv.DBOperation("SELECT"),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	if err := tracker.createTable(ctx); err != nil {
+		return stats, fmt.Errorf("%s: %w", op, err)
+	}
+
+	where := "workspace = ? AND url_alias = ?"
+	args := []any{filter.Workspace, filter.Alias}
+	if !filter.IncludeBots {
+		where += " AND NOT bot"
+	}
+	if !filter.From.IsZero() {
+		where += " AND timestamp >= ?"
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		where += " AND timestamp < ?"
+		args = append(args, filter.To.UTC())
+	}
+
+	var failed uint64
+	summaryQuery := fmt.Sprintf(`
+		SELECT
+			count(),
+			uniqExact(%s),
+			countIf(error != '')
+		FROM %s.clicks
+		WHERE %s
+	`, visitor, tracker.dbName, where)
+	err = tracker.db.QueryRowContext(ctx, summaryQuery, args...).
+		Scan(&stats.TotalClicks, &stats.UniqueVisitors, &failed)
+	if err != nil {
+		return stats, fmt.Errorf("%s: failed to count clicks: %w", op, err)
+	}
+	if stats.TotalClicks > 0 {
+		stats.ErrorRate = float64(failed) / float64(stats.TotalClicks)
+	}
+
+	bucket := "toStartOfDay(timestamp, 'UTC')"
+	if filter.Granularity == analytics.GranularityHour {
+		bucket = "toStartOfHour(timestamp, 'UTC')"
+	}
+	bucketsQuery := fmt.Sprintf(`
+		SELECT %s AS bucket, count(), uniqExact(%s)
+		FROM %s.clicks
+		WHERE %s
+		GROUP BY bucket
+		ORDER BY bucket
+	`, bucket, visitor, tracker.dbName, where)
+	stats.Clicks, err = tracker.queryBuckets(ctx, bucketsQuery, args)
+	if err != nil {
+		return stats, fmt.Errorf("%s: failed to count clicks over time: %w", op, err)
+	}
+
+	stats.TopReferrers, err = tracker.queryTop(ctx, "referrer", where, args, filter.Top)
+	if err != nil {
+		return stats, fmt.Errorf("%s: failed to count referrers: %w", op, err)
+	}
+
+	stats.TopUserAgents, err = tracker.queryTop(ctx, "user_agent", where, args, filter.Top)
+	if err != nil {
+		return stats, fmt.Errorf("%s: failed to count user agents: %w", op, err)
+	}
+
+	stats.Devices, err = tracker.queryTop(ctx, "device", where, args, filter.Top)
+	if err != nil {
+		return stats, fmt.Errorf("%s: failed to count devices: %w", op, err)
+	}
+
+	stats.OperatingSystems, err = tracker.queryTop(ctx, "os", where, args, filter.Top)
+	if err != nil {
+		return stats, fmt.Errorf("%s: failed to count operating systems: %w", op, err)
+	}
+
+	stats.Browsers, err = tracker.queryTop(ctx, "browser", where, args, filter.Top)
+	if err != nil {
+		return stats, fmt.Errorf("%s: failed to count browsers: %w", op, err)
+	}
+
+	return stats, nil
+}
+
+func (tracker *AnalyticsTracker) queryBuckets(ctx context.Context, query string, args []any) ([]analytics.TimeBucket, error) {
+	rows, err := tracker.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	buckets := []analytics.TimeBucket{}
+	for rows.Next() {
+		var bucket analytics.TimeBucket
+		if err := rows.Scan(&bucket.Time, &bucket.Clicks, &bucket.UniqueVisitors); err != nil {
+			return nil, err
+		}
+		bucket.Time = bucket.Time.UTC()
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, rows.Err()
+}
+
+// queryTop counts clicks by the values of column, most clicked first.
+func (tracker *AnalyticsTracker) queryTop(ctx context.Context, column, where string, args []any, limit int) ([]analytics.Count, error) {
+	query := fmt.Sprintf(`
+		SELECT %s AS value, count() AS clicks
+		FROM %s.clicks
+		WHERE %s
+		GROUP BY value
+		ORDER BY clicks DESC, value
+		LIMIT ?
+	`, column, tracker.dbName, where)
+
+	rows, err := tracker.db.QueryContext(ctx, query, append(args[:len(args):len(args)], limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	counts := []analytics.Count{}
+	for rows.Next() {
+		var count analytics.Count
+		if err := rows.Scan(&count.Value, &count.Clicks); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
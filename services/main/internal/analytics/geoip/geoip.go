@@ -0,0 +1,209 @@
+// Package geoip locates clicks by the client IP in MaxMind-format (MMDB)
+// databases, such as GeoLite2 City and ASN.
+//
+// Databases are read into memory and checked for changes periodically, a
+// changed database replaces the loaded one without stopping lookups.
+package geoip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/raisultan/url-shortener/lib/logger/sl"
+	"github.com/raisultan/url-shortener/services/main/internal/analytics"
+	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"golang.org/x/exp/slog"
+)
+
+const language = "en"
+
+type Location struct {
+	Country string
+	Region  string
+	City    string
+	ASN     uint32
+	ASOrg   string
+}
+
+// record holds the fields of City, Country and ASN databases a click is
+// located by, a database fills the ones it has.
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	ASN   uint32 `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+type AnalyticsTracker interface {
+	TrackClickEvent(ctx context.Context, event analytics.ClickEvent) error
+}
+
+type database struct {
+	path    string
+	reader  atomic.Pointer[maxminddb.Reader]
+	modTime time.Time
+	size    int64
+}
+
+type Tracker struct {
+	log       *slog.Logger
+	next      AnalyticsTracker
+	databases []*database
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New locates events before passing them to next. Databases are checked for
+// changes every cfg.CheckInterval.
+func New(log *slog.Logger, cfg config.GeoIP, next AnalyticsTracker) (*Tracker, error) {
+	const op = "analytics.geoip.New"
+
+	if cfg.CheckInterval <= 0 {
+		return nil, fmt.Errorf("%s: check interval must be positive", op)
+	}
+
+	t := &Tracker{
+		log: log.With(
+			slog.String("component", "analytics/geoip"),
+		),
+		next: next,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	for _, path := range cfg.Databases {
+		db := &database{path: path}
+		if err := t.load(db); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		t.databases = append(t.databases, db)
+	}
+
+	go t.watch(cfg.CheckInterval)
+
+	return t, nil
+}
+
+func (t *Tracker) TrackClickEvent(ctx context.Context, event analytics.ClickEvent) error {
+	location := t.Lookup(event.IP)
+	event.Country = location.Country
+	event.Region = location.Region
+	event.City = location.City
+	event.ASN = location.ASN
+	event.ASOrg = location.ASOrg
+
+	return t.next.TrackClickEvent(ctx, event)
+}
+
+// Lookup locates ip, fields no database knows are left empty.
+func (t *Tracker) Lookup(ip string) Location {
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return Location{}
+	}
+
+	var location Location
+	for _, db := range t.databases {
+		var rec record
+		if err := db.reader.Load().Lookup(parsed, &rec); err != nil {
+			t.log.Warn("failed to look up ip", slog.String("database", db.path), sl.Err(err))
+			continue
+		}
+
+		if location.Country == "" {
+			location.Country = rec.Country.ISOCode
+		}
+		if location.Region == "" && len(rec.Subdivisions) > 0 {
+			location.Region = rec.Subdivisions[0].Names[language]
+		}
+		if location.City == "" {
+			location.City = rec.City.Names[language]
+		}
+		if location.ASN == 0 {
+			location.ASN = rec.ASN
+			location.ASOrg = rec.ASOrg
+		}
+	}
+
+	return location
+}
+
+// load reads db unless its file is unchanged since it was last read.
+func (t *Tracker) load(db *database) error {
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return err
+	}
+
+	if db.reader.Load() != nil && info.ModTime().Equal(db.modTime) && info.Size() == db.size {
+		return nil
+	}
+
+	// the reader keeps no file open, so lookups in flight can go on with the
+	// replaced one
+	buf, err := os.ReadFile(db.path)
+	if err != nil {
+		return err
+	}
+
+	reader, err := maxminddb.FromBytes(buf)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", db.path, err)
+	}
+
+	db.reader.Store(reader)
+	db.modTime = info.ModTime()
+	db.size = info.Size()
+
+	t.log.Info("geoip database loaded",
+		slog.String("database", db.path),
+		slog.String("type", reader.Metadata.DatabaseType),
+	)
+
+	return nil
+}
+
+func (t *Tracker) watch(interval time.Duration) {
+	defer close(t.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			for _, db := range t.databases {
+				// a database being replaced may be read half written, the
+				// loaded one is kept until the file can be read
+				if err := t.load(db); err != nil {
+					t.log.Error("failed to reload geoip database", slog.String("database", db.path), sl.Err(err))
+				}
+			}
+		}
+	}
+}
+
+// Close stops checking the databases for changes.
+func (t *Tracker) Close() {
+	close(t.stop)
+	<-t.done
+}
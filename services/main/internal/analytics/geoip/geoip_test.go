@@ -0,0 +1,168 @@
+package geoip
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/raisultan/url-shortener/services/main/internal/analytics"
+	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+type recorder struct {
+	events []analytics.ClickEvent
+}
+
+func (r *recorder) TrackClickEvent(_ context.Context, event analytics.ClickEvent) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestTracker(t *testing.T) {
+	dir := t.TempDir()
+	city := filepath.Join(dir, "city.mmdb")
+	asn := filepath.Join(dir, "asn.mmdb")
+	writeDatabase(t, city, "GeoLite2-City", mmdbMap{
+		{"country", mmdbMap{{"iso_code", "NL"}}},
+		{"subdivisions", []any{mmdbMap{{"names", mmdbMap{{"en", "North Holland"}}}}}},
+		{"city", mmdbMap{{"names", mmdbMap{{"en", "Amsterdam"}}}}},
+	})
+	writeDatabase(t, asn, "GeoLite2-ASN", mmdbMap{
+		{"autonomous_system_number", uint32(1136)},
+		{"autonomous_system_organization", "KPN B.V."},
+	})
+
+	log := slog.New(slog.NewTextHandler(httptest.NewRecorder(), nil))
+	next := &recorder{}
+	tracker, err := New(log, config.GeoIP{
+		Databases:     []string{city, asn},
+		CheckInterval: 10 * time.Millisecond,
+	}, next)
+	require.NoError(t, err)
+	defer tracker.Close()
+
+	require.NoError(t, tracker.TrackClickEvent(context.Background(), analytics.ClickEvent{IP: "1.2.3.4:5678"}))
+	event := next.events[0]
+	require.Equal(t, "NL", event.Country)
+	require.Equal(t, "North Holland", event.Region)
+	require.Equal(t, "Amsterdam", event.City)
+	require.Equal(t, uint32(1136), event.ASN)
+	require.Equal(t, "KPN B.V.", event.ASOrg)
+
+	require.Equal(t, Location{}, tracker.Lookup("203.0.113.7"), "only 0.0.0.0/1 is in the databases")
+	require.Equal(t, Location{}, tracker.Lookup("not an ip"))
+
+	writeDatabase(t, city, "GeoLite2-City", mmdbMap{{"country", mmdbMap{{"iso_code", "DE"}}}})
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(city, later, later))
+
+	require.Eventually(t, func() bool {
+		return tracker.Lookup("1.2.3.4").Country == "DE"
+	}, time.Second, 10*time.Millisecond, "a changed database is reloaded")
+	require.Equal(t, uint32(1136), tracker.Lookup("1.2.3.4").ASN)
+}
+
+func TestNewWithoutDatabase(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(httptest.NewRecorder(), nil))
+	_, err := New(log, config.GeoIP{
+		Databases:     []string{filepath.Join(t.TempDir(), "missing.mmdb")},
+		CheckInterval: time.Minute,
+	}, &recorder{})
+	require.Error(t, err)
+}
+
+// mmdbMap is a map keeping the order of its keys.
+type mmdbMap []struct {
+	key   string
+	value any
+}
+
+// writeDatabase writes an IPv4 database where 0.0.0.0/1 has data and
+// 128.0.0.0/1 has none.
+func writeDatabase(t *testing.T, path, databaseType string, data mmdbMap) {
+	t.Helper()
+
+	const nodeCount = 1
+
+	var buf bytes.Buffer
+	// a single node of two 24 bit records, the left one points at the start
+	// of the data section and the right one, equal to the node count, is empty
+	left := nodeCount + 16
+	buf.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), 0, 0, nodeCount})
+	buf.Write(make([]byte, 16))
+	encode(&buf, data)
+
+	buf.WriteString("\xab\xcd\xefMaxMind.com")
+	encode(&buf, mmdbMap{
+		{"node_count", uint32(nodeCount)},
+		{"record_size", uint16(24)},
+		{"ip_version", uint16(4)},
+		{"database_type", databaseType},
+		{"languages", []any{"en"}},
+		{"binary_format_major_version", uint16(2)},
+		{"binary_format_minor_version", uint16(0)},
+		{"build_epoch", uint64(0)},
+		{"description", mmdbMap{}},
+	})
+
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+}
+
+// encode writes values in the MaxMind DB data format, sizes up to 284 only.
+func encode(buf *bytes.Buffer, value any) {
+	control := func(typ, size int) {
+		sizeBits, extra := size, -1
+		if size >= 29 {
+			sizeBits, extra = 29, size-29
+		}
+
+		if typ > 7 {
+			buf.WriteByte(byte(sizeBits))
+			buf.WriteByte(byte(typ - 7))
+		} else {
+			buf.WriteByte(byte(typ<<5 | sizeBits))
+		}
+		if extra >= 0 {
+			buf.WriteByte(byte(extra))
+		}
+	}
+	unsigned := func(typ int, v uint64) {
+		var b []byte
+		for ; v > 0; v >>= 8 {
+			b = append([]byte{byte(v)}, b...)
+		}
+		control(typ, len(b))
+		buf.Write(b)
+	}
+
+	switch v := value.(type) {
+	case string:
+		control(2, len(v))
+		buf.WriteString(v)
+	case uint16:
+		unsigned(5, uint64(v))
+	case uint32:
+		unsigned(6, uint64(v))
+	case uint64:
+		unsigned(9, v)
+	case mmdbMap:
+		control(7, len(v))
+		for _, entry := range v {
+			encode(buf, entry.key)
+			encode(buf, entry.value)
+		}
+	case []any:
+		control(11, len(v))
+		for _, item := range v {
+			encode(buf, item)
+		}
+	default:
+		panic("unsupported type")
+	}
+}
@@ -0,0 +1,76 @@
+// Package jsonl writes click events as JSON lines to a file or stdout.
+package jsonl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/raisultan/url-shortener/lib/logger/sl"
+	"github.com/raisultan/url-shortener/services/main/internal/analytics"
+	"golang.org/x/exp/slog"
+)
+
+type Sink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+func New(w io.Writer) *Sink {
+	return &Sink{w: w}
+}
+
+// NewFile appends events to the file at path.
+func NewFile(path string) (*Sink, error) {
+	const op = "analytics.jsonl.NewFile"
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Sink{w: file, closer: file}, nil
+}
+
+// InsertClickEvents writes events with a single write, so lines of
+// concurrent batches don't interleave.
+func (s *Sink) InsertClickEvents(_ context.Context, events []analytics.ClickEvent) error {
+	const op = "analytics.jsonl.InsertClickEvents"
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Sink) Close(log *slog.Logger) {
+	if s.closer == nil {
+		return
+	}
+
+	if err := s.closer.Close(); err != nil {
+		log.Error("could not close click events file", sl.Err(err))
+	}
+}
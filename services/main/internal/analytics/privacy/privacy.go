@@ -0,0 +1,123 @@
+// Package privacy takes personal data out of click events before they are
+// stored.
+//
+// Visitors are identified by a hash of their IP and user agent keyed with a
+// salt derived from a secret and the day of the click, so a visitor can be
+// counted once a day but not followed across days, and the hash can't be
+// reversed without the secret.
+package privacy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/raisultan/url-shortener/services/main/internal/analytics"
+	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// IPFull keeps the address.
+	IPFull = "full"
+	// IPTruncate keeps the /24 network of IPv4 and the /48 network of IPv6
+	// addresses.
+	IPTruncate = "truncate"
+	// IPDrop keeps no address.
+	IPDrop = "drop"
+)
+
+var (
+	ipv4Mask = net.CIDRMask(24, 32)
+	ipv6Mask = net.CIDRMask(48, 128)
+)
+
+type AnalyticsTracker interface {
+	TrackClickEvent(ctx context.Context, event analytics.ClickEvent) error
+}
+
+type Tracker struct {
+	next   AnalyticsTracker
+	ipMode string
+	secret []byte
+}
+
+// New anonymizes events before passing them to next. Without a configured
+// salt a random one is used, visitors are then counted apart by every
+// instance and after restarts.
+func New(log *slog.Logger, cfg config.Privacy, next AnalyticsTracker) (*Tracker, error) {
+	const op = "analytics.privacy.New"
+
+	switch cfg.IPMode {
+	case IPFull, IPTruncate, IPDrop:
+	default:
+		return nil, fmt.Errorf("%s: unsupported ip mode: %s", op, cfg.IPMode)
+	}
+
+	secret := []byte(cfg.VisitorSalt)
+	if len(secret) == 0 {
+		log.Warn("visitor salt is not configured, using a random one")
+
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return &Tracker{next: next, ipMode: cfg.IPMode, secret: secret}, nil
+}
+
+func (t *Tracker) TrackClickEvent(ctx context.Context, event analytics.ClickEvent) error {
+	ip := hostOf(event.IP)
+	event.VisitorID = t.VisitorID(event.Timestamp, ip, event.UserAgent)
+	event.IP = Anonymize(t.ipMode, ip)
+
+	return t.next.TrackClickEvent(ctx, event)
+}
+
+// VisitorID hashes ip and userAgent with the salt of the UTC day of at.
+func (t *Tracker) VisitorID(at time.Time, ip, userAgent string) string {
+	salt := hmac.New(sha256.New, t.secret)
+	salt.Write([]byte(at.UTC().Format(time.DateOnly)))
+
+	mac := hmac.New(sha256.New, salt.Sum(nil))
+	mac.Write([]byte(ip))
+	mac.Write([]byte{0})
+	mac.Write([]byte(userAgent))
+
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Anonymize applies mode to ip, addresses that can't be parsed are dropped
+// unless mode is IPFull.
+func Anonymize(mode, ip string) string {
+	switch mode {
+	case IPFull:
+		return ip
+	case IPTruncate:
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return ""
+		}
+		if v4 := parsed.To4(); v4 != nil {
+			return v4.Mask(ipv4Mask).String()
+		}
+		return parsed.Mask(ipv6Mask).String()
+	default:
+		return ""
+	}
+}
+
+// hostOf strips the port of addr, if it has one.
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return addr
+}
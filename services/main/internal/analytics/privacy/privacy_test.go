@@ -0,0 +1,69 @@
+package privacy
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/raisultan/url-shortener/services/main/internal/analytics"
+	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+type recorder struct {
+	events []analytics.ClickEvent
+}
+
+func (r *recorder) TrackClickEvent(_ context.Context, event analytics.ClickEvent) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestAnonymize(t *testing.T) {
+	cases := []struct {
+		mode, ip, want string
+	}{
+		{IPFull, "203.0.113.7", "203.0.113.7"},
+		{IPTruncate, "203.0.113.7", "203.0.113.0"},
+		{IPTruncate, "2001:db8:abcd:12::1", "2001:db8:abcd::"},
+		{IPTruncate, "not an ip", ""},
+		{IPDrop, "203.0.113.7", ""},
+	}
+
+	for _, tc := range cases {
+		require.Equal(t, tc.want, Anonymize(tc.mode, tc.ip), "%s %s", tc.mode, tc.ip)
+	}
+}
+
+func TestTracker(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(httptest.NewRecorder(), nil))
+	next := &recorder{}
+	tracker, err := New(log, config.Privacy{IPMode: IPTruncate, VisitorSalt: "secret"}, next)
+	require.NoError(t, err)
+
+	day := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	track := func(at time.Time, ip, ua string) analytics.ClickEvent {
+		require.NoError(t, tracker.TrackClickEvent(context.Background(), analytics.ClickEvent{
+			Timestamp: at,
+			IP:        ip,
+			UserAgent: ua,
+		}))
+		return next.events[len(next.events)-1]
+	}
+
+	first := track(day, "203.0.113.7:51234", "curl")
+	require.Equal(t, "203.0.113.0", first.IP)
+	require.NotEmpty(t, first.VisitorID)
+
+	require.Equal(t, first.VisitorID, track(day.Add(time.Hour), "203.0.113.7:40000", "curl").VisitorID,
+		"the port doesn't change the visitor")
+	require.NotEqual(t, first.VisitorID, track(day, "203.0.113.8:51234", "curl").VisitorID)
+	require.NotEqual(t, first.VisitorID, track(day, "203.0.113.7:51234", "wget").VisitorID)
+	require.NotEqual(t, first.VisitorID, track(day.AddDate(0, 0, 1), "203.0.113.7:51234", "curl").VisitorID,
+		"the salt rotates daily")
+
+	_, err = New(log, config.Privacy{IPMode: "scramble"}, next)
+	require.Error(t, err)
+}
@@ -0,0 +1,181 @@
+// Package queue takes click events off the request path, a background worker
+// inserts them in batches.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/raisultan/url-shortener/lib/logger/sl"
+	"github.com/raisultan/url-shortener/services/main/internal/analytics"
+	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"github.com/raisultan/url-shortener/services/main/internal/metrics"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	BackpressureDrop  = "drop"
+	BackpressureBlock = "block"
+)
+
+var (
+	ErrQueueFull = errors.New("analytics queue is full")
+	ErrClosed    = errors.New("analytics queue is closed")
+)
+
+type Sink interface {
+	InsertClickEvents(ctx context.Context, events []analytics.ClickEvent) error
+}
+
+type Queue struct {
+	log           *slog.Logger
+	sink          Sink
+	batchSize     int
+	flushInterval time.Duration
+	insertTimeout time.Duration
+	block         bool
+	dropped       prometheus.Counter
+
+	// mu guards closed, senders hold it for reading so the channel is not
+	// closed under them.
+	mu     sync.RWMutex
+	closed bool
+	events chan analytics.ClickEvent
+	done   chan struct{}
+}
+
+// New queues events of the named sink.
+func New(log *slog.Logger, name string, sink Sink, cfg config.Analytics) (*Queue, error) {
+	const op = "analytics.queue.New"
+
+	var block bool
+	switch cfg.Backpressure {
+	case BackpressureDrop:
+	case BackpressureBlock:
+		block = true
+	default:
+		return nil, fmt.Errorf("%s: unsupported backpressure policy: %s", op, cfg.Backpressure)
+	}
+
+	if cfg.FlushInterval <= 0 {
+		return nil, fmt.Errorf("%s: flush interval must be positive", op)
+	}
+
+	q := &Queue{
+		log: log.With(
+			slog.String("component", "analytics/queue"),
+			slog.String("sink", name),
+		),
+		sink:          sink,
+		batchSize:     max(cfg.BatchSize, 1),
+		flushInterval: cfg.FlushInterval,
+		insertTimeout: cfg.InsertTimeout,
+		block:         block,
+		dropped:       metrics.AnalyticsDroppedEvents.WithLabelValues(name),
+		events:        make(chan analytics.ClickEvent, max(cfg.QueueSize, 1)),
+		done:          make(chan struct{}),
+	}
+
+	go q.run()
+
+	return q, nil
+}
+
+// TrackClickEvent queues the event. While the queue is full it is dropped or,
+// with the block policy, waits for room until ctx is done.
+func (q *Queue) TrackClickEvent(ctx context.Context, event analytics.ClickEvent) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		q.dropped.Inc()
+		return ErrClosed
+	}
+
+	if q.block {
+		select {
+		case q.events <- event:
+			return nil
+		case <-ctx.Done():
+			q.dropped.Inc()
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case q.events <- event:
+		return nil
+	default:
+		q.dropped.Inc()
+		return ErrQueueFull
+	}
+}
+
+// Close stops taking events and waits until the queued ones are inserted.
+func (q *Queue) Close(ctx context.Context) error {
+	const op = "analytics.queue.Close"
+
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.events)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", op, ctx.Err())
+	}
+}
+
+func (q *Queue) run() {
+	defer close(q.done)
+
+	ticker := time.NewTicker(q.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]analytics.ClickEvent, 0, q.batchSize)
+	for {
+		select {
+		case event, ok := <-q.events:
+			if !ok {
+				q.flush(batch)
+				return
+			}
+
+			batch = append(batch, event)
+			if len(batch) < q.batchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		q.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+func (q *Queue) flush(batch []analytics.ClickEvent) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), q.insertTimeout)
+	defer cancel()
+
+	if err := q.sink.InsertClickEvents(ctx, batch); err != nil {
+		q.log.Error("failed to insert click events", slog.Int("count", len(batch)), sl.Err(err))
+		return
+	}
+
+	q.log.Debug("click events inserted", slog.Int("count", len(batch)))
+}
@@ -0,0 +1,118 @@
+package queue
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/raisultan/url-shortener/services/main/internal/analytics"
+	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+type sink struct {
+	mu      sync.Mutex
+	batches [][]analytics.ClickEvent
+	// release blocks inserts until it is closed, if set
+	release chan struct{}
+}
+
+func (s *sink) InsertClickEvents(_ context.Context, events []analytics.ClickEvent) error {
+	if s.release != nil {
+		<-s.release
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, append([]analytics.ClickEvent(nil), events...))
+
+	return nil
+}
+
+func (s *sink) sizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res []int
+	for _, batch := range s.batches {
+		res = append(res, len(batch))
+	}
+
+	return res
+}
+
+func newQueue(t *testing.T, s Sink, cfg config.Analytics) *Queue {
+	log := slog.New(slog.NewTextHandler(httptest.NewRecorder(), nil))
+	if cfg.InsertTimeout == 0 {
+		cfg.InsertTimeout = time.Second
+	}
+
+	q, err := New(log, "test", s, cfg)
+	require.NoError(t, err)
+
+	return q
+}
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+	s := &sink{}
+	q := newQueue(t, s, config.Analytics{
+		QueueSize:     10,
+		BatchSize:     3,
+		FlushInterval: 50 * time.Millisecond,
+		Backpressure:  BackpressureDrop,
+	})
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, q.TrackClickEvent(ctx, analytics.ClickEvent{URLAlias: "a"}))
+	}
+
+	require.Eventually(t, func() bool {
+		return len(s.sizes()) == 2
+	}, time.Second, 10*time.Millisecond, "a full batch and the rest after the flush interval")
+	require.Equal(t, []int{3, 1}, s.sizes())
+
+	require.NoError(t, q.TrackClickEvent(ctx, analytics.ClickEvent{URLAlias: "b"}))
+	require.NoError(t, q.Close(ctx))
+	require.Equal(t, []int{3, 1, 1}, s.sizes(), "queued events are flushed on close")
+
+	require.ErrorIs(t, q.TrackClickEvent(ctx, analytics.ClickEvent{}), ErrClosed)
+}
+
+func TestQueue_Backpressure(t *testing.T) {
+	s := &sink{release: make(chan struct{})}
+	cfg := config.Analytics{
+		QueueSize:     1,
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+	}
+
+	cfg.Backpressure = BackpressureDrop
+	q := newQueue(t, s, cfg)
+
+	// the worker takes the first event and waits on the sink, the second one
+	// fills the queue
+	require.NoError(t, q.TrackClickEvent(context.Background(), analytics.ClickEvent{}))
+	require.Eventually(t, func() bool { return len(q.events) == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, q.TrackClickEvent(context.Background(), analytics.ClickEvent{}))
+	require.ErrorIs(t, q.TrackClickEvent(context.Background(), analytics.ClickEvent{}), ErrQueueFull)
+
+	cfg.Backpressure = BackpressureBlock
+	blocking := newQueue(t, s, cfg)
+
+	require.NoError(t, blocking.TrackClickEvent(context.Background(), analytics.ClickEvent{}))
+	require.Eventually(t, func() bool { return len(blocking.events) == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, blocking.TrackClickEvent(context.Background(), analytics.ClickEvent{}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, blocking.TrackClickEvent(ctx, analytics.ClickEvent{}), context.DeadlineExceeded)
+
+	close(s.release)
+	require.NoError(t, q.Close(context.Background()))
+	require.NoError(t, blocking.Close(context.Background()))
+	require.Equal(t, []int{1, 1, 1, 1}, s.sizes())
+}
@@ -0,0 +1,129 @@
+// Package sinks fans click events out to every enabled analytics sink.
+package sinks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/raisultan/url-shortener/services/main/internal/analytics"
+	"github.com/raisultan/url-shortener/services/main/internal/analytics/queue"
+	"github.com/raisultan/url-shortener/services/main/internal/analytics/spool"
+	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"github.com/raisultan/url-shortener/services/main/internal/metrics"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	ClickHouse = "clickhouse"
+	File       = "file"
+	Stdout     = "stdout"
+	Webhook    = "webhook"
+)
+
+type Sink interface {
+	InsertClickEvents(ctx context.Context, events []analytics.ClickEvent) error
+}
+
+type closer interface {
+	Close(log *slog.Logger)
+}
+
+// pipeline carries events to a sink, every sink has a queue and a spool of its
+// own, so a slow or failing sink doesn't hold back the others.
+type pipeline struct {
+	name  string
+	sink  Sink
+	spool *spool.Spool
+	queue *queue.Queue
+}
+
+type Registry struct {
+	log       *slog.Logger
+	cfg       config.Analytics
+	pipelines []pipeline
+}
+
+func New(log *slog.Logger, cfg config.Analytics) *Registry {
+	return &Registry{log: log, cfg: cfg}
+}
+
+// Add routes events to the named sink, sinks that have a Close method are
+// closed with the registry.
+func (r *Registry) Add(name string, sink Sink) error {
+	const op = "analytics.sinks.Add"
+
+	p := pipeline{name: name, sink: sink}
+
+	// the spool counts failed inserts itself, so retries are not counted again
+	var next queue.Sink = counted{name: name, sink: sink}
+	if r.cfg.Spool.Dir != "" {
+		s, err := spool.New(r.log, name, sink, r.cfg)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		p.spool = s
+		next = s
+	}
+
+	q, err := queue.New(r.log, name, next, r.cfg)
+	if err != nil {
+		if p.spool != nil {
+			p.spool.Close(r.log)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	p.queue = q
+
+	r.pipelines = append(r.pipelines, p)
+
+	return nil
+}
+
+// TrackClickEvent queues the event for every sink.
+func (r *Registry) TrackClickEvent(ctx context.Context, event analytics.ClickEvent) error {
+	var errs []error
+	for _, p := range r.pipelines {
+		if err := p.queue.TrackClickEvent(ctx, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Close flushes queued events and closes the sinks.
+func (r *Registry) Close(ctx context.Context) error {
+	var errs []error
+	for _, p := range r.pipelines {
+		if err := p.queue.Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.name, err))
+		}
+
+		if p.spool != nil {
+			p.spool.Close(r.log)
+		}
+
+		if c, ok := p.sink.(closer); ok {
+			c.Close(r.log)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// counted counts events the sink failed to insert.
+type counted struct {
+	name string
+	sink Sink
+}
+
+func (c counted) InsertClickEvents(ctx context.Context, events []analytics.ClickEvent) error {
+	err := c.sink.InsertClickEvents(ctx, events)
+	if err != nil {
+		metrics.AnalyticsInsertFailures.WithLabelValues(c.name).Add(float64(len(events)))
+	}
+
+	return err
+}
@@ -0,0 +1,51 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raisultan/url-shortener/services/main/internal/analytics"
+	"github.com/raisultan/url-shortener/services/main/internal/analytics/jsonl"
+	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+type failing struct{}
+
+func (failing) InsertClickEvents(context.Context, []analytics.ClickEvent) error {
+	return errors.New("unavailable")
+}
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(httptest.NewRecorder(), nil))
+	r := New(log, config.Analytics{
+		QueueSize:     10,
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+		InsertTimeout: time.Second,
+		Backpressure:  "drop",
+	})
+
+	var first, second bytes.Buffer
+	require.NoError(t, r.Add("first", jsonl.New(&first)))
+	require.NoError(t, r.Add("failing", failing{}))
+	require.NoError(t, r.Add("second", jsonl.New(&second)))
+
+	require.NoError(t, r.TrackClickEvent(ctx, analytics.ClickEvent{URLAlias: "a"}))
+	require.NoError(t, r.TrackClickEvent(ctx, analytics.ClickEvent{URLAlias: "b"}))
+	require.NoError(t, r.Close(ctx))
+
+	for _, out := range []string{first.String(), second.String()} {
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		require.Len(t, lines, 2, "a failing sink doesn't hold back the others")
+		require.Contains(t, lines[0], `"url_alias":"a"`)
+		require.Contains(t, lines[1], `"url_alias":"b"`)
+	}
+}
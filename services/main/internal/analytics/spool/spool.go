@@ -0,0 +1,439 @@
+// Package spool keeps click events an analytics sink failed to take on
+// disk and replays them in order once it is back.
+//
+// Events are appended as JSON lines to segment files named by an increasing
+// sequence number. A segment is replayed with a single insert and removed
+// once the insert succeeds, so an event may be inserted twice if the service
+// stops between the two, but it is never lost. A segment the sink keeps
+// rejecting is renamed with a ".failed" extension and left for an operator,
+// so it doesn't hold back the segments after it. Quarantined segments count
+// toward the size limit of the spool until they are removed.
+package spool
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/raisultan/url-shortener/lib/logger/sl"
+	"github.com/raisultan/url-shortener/services/main/internal/analytics"
+	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"github.com/raisultan/url-shortener/services/main/internal/metrics"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	segmentExt    = ".jsonl"
+	quarantineExt = ".failed"
+)
+
+var ErrFull = errors.New("analytics spool is full")
+
+type Sink interface {
+	InsertClickEvents(ctx context.Context, events []analytics.ClickEvent) error
+}
+
+type segment struct {
+	path string
+	size int64
+}
+
+type Spool struct {
+	log           *slog.Logger
+	sink          Sink
+	dir           string
+	segmentSize   int64
+	maxSize       int64
+	retryInterval time.Duration
+	insertTimeout time.Duration
+	maxAttempts   int
+	failures      prometheus.Counter
+	dropped       prometheus.Counter
+	quarantined   prometheus.Counter
+	bytes         prometheus.Gauge
+	failedBytes   prometheus.Gauge
+
+	// attempts counts failed replays of the oldest segment, only replays
+	// touch it.
+	attempts int
+
+	// mu guards the segments, inserts hold it so events spooled meanwhile
+	// can't overtake them.
+	mu         sync.Mutex
+	segments   []segment
+	active     *os.File
+	activeSize int64
+	size       int64
+	failedSize int64
+	nextSeq    uint64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New spools events of the named sink in a directory of its own under
+// cfg.Spool.Dir, it picks up segments left by a previous run and starts
+// replaying them.
+func New(log *slog.Logger, name string, sink Sink, cfg config.Analytics) (*Spool, error) {
+	const op = "analytics.spool.New"
+
+	if cfg.Spool.RetryInterval <= 0 {
+		return nil, fmt.Errorf("%s: retry interval must be positive", op)
+	}
+
+	dir := filepath.Join(cfg.Spool.Dir, name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s := &Spool{
+		log: log.With(
+			slog.String("component", "analytics/spool"),
+			slog.String("sink", name),
+		),
+		sink:          sink,
+		dir:           dir,
+		segmentSize:   cfg.Spool.SegmentSize,
+		maxSize:       cfg.Spool.MaxSize,
+		retryInterval: cfg.Spool.RetryInterval,
+		insertTimeout: cfg.InsertTimeout,
+		maxAttempts:   cfg.Spool.MaxAttempts,
+		failures:      metrics.AnalyticsInsertFailures.WithLabelValues(name),
+		dropped:       metrics.AnalyticsDroppedEvents.WithLabelValues(name),
+		quarantined:   metrics.AnalyticsQuarantinedSegments.WithLabelValues(name),
+		bytes:         metrics.AnalyticsSpoolBytes.WithLabelValues(name),
+		failedBytes:   metrics.AnalyticsQuarantinedBytes.WithLabelValues(name),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	if err := s.load(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(s.segments) > 0 {
+		s.log.Info("found spooled click events",
+			slog.Int("segments", len(s.segments)),
+			slog.Int64("bytes", s.size),
+		)
+	}
+
+	if s.failedSize > 0 {
+		s.log.Warn("found quarantined spool segments", slog.Int64("bytes", s.failedSize))
+	}
+
+	go s.run()
+
+	return s, nil
+}
+
+func (s *Spool) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	var seqs []uint64
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name, failed := strings.CutSuffix(entry.Name(), quarantineExt)
+		name, ok := strings.CutSuffix(name, segmentExt)
+		if !ok {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		// new segments must not take the sequence of a quarantined one
+		s.nextSeq = max(s.nextSeq, seq+1)
+
+		if failed {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			s.failedSize += info.Size()
+			continue
+		}
+
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	for _, seq := range seqs {
+		path := s.segmentPath(seq)
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		s.segments = append(s.segments, segment{path: path, size: info.Size()})
+		s.size += info.Size()
+	}
+
+	s.bytes.Set(float64(s.size))
+	s.failedBytes.Set(float64(s.failedSize))
+
+	return nil
+}
+
+// InsertClickEvents inserts events into the sink, or spools them if the sink
+// fails or older events are still waiting to be replayed. Failed inserts are
+// counted once, replays of the spooled events are not counted again.
+func (s *Spool) InsertClickEvents(ctx context.Context, events []analytics.ClickEvent) error {
+	const op = "analytics.spool.InsertClickEvents"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.segments) == 0 && s.activeSize == 0 {
+		err := s.sink.InsertClickEvents(ctx, events)
+		if err == nil {
+			return nil
+		}
+
+		s.failures.Add(float64(len(events)))
+		s.log.Warn("analytics sink is unavailable, spooling click events", sl.Err(err))
+	}
+
+	if err := s.append(events); err != nil {
+		s.dropped.Add(float64(len(events)))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Spool) append(events []analytics.ClickEvent) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return err
+		}
+	}
+
+	if s.maxSize > 0 && s.size+s.failedSize+int64(buf.Len()) > s.maxSize {
+		return ErrFull
+	}
+
+	if s.active == nil {
+		file, err := os.OpenFile(s.segmentPath(s.nextSeq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+
+		s.active = file
+		s.nextSeq++
+	}
+
+	n, err := s.active.Write(buf.Bytes())
+	s.activeSize += int64(n)
+	s.size += int64(n)
+	s.bytes.Set(float64(s.size))
+	if err != nil {
+		return err
+	}
+
+	if err := s.active.Sync(); err != nil {
+		return err
+	}
+
+	if s.activeSize >= s.segmentSize {
+		return s.rotate()
+	}
+
+	return nil
+}
+
+// rotate closes the active segment, the next append starts a new one.
+func (s *Spool) rotate() error {
+	if s.active == nil {
+		return nil
+	}
+
+	path := s.active.Name()
+	err := s.active.Close()
+
+	s.segments = append(s.segments, segment{path: path, size: s.activeSize})
+	s.active = nil
+	s.activeSize = 0
+
+	return err
+}
+
+func (s *Spool) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.retryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.replayAll()
+		}
+	}
+}
+
+// replayAll replays segments until the spool is empty, the sink fails or the
+// spool is closed.
+func (s *Spool) replayAll() {
+	for s.replay() {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+	}
+}
+
+// replay inserts the oldest segment, it reports whether the segment is done
+// and the next one may be replayed right away.
+func (s *Spool) replay() bool {
+	s.mu.Lock()
+	if len(s.segments) == 0 {
+		if err := s.rotate(); err != nil {
+			s.log.Error("failed to close spool segment", sl.Err(err))
+		}
+	}
+	if len(s.segments) == 0 {
+		s.mu.Unlock()
+		return false
+	}
+	seg := s.segments[0]
+	s.mu.Unlock()
+
+	events, err := s.read(seg.path)
+	if err != nil {
+		s.log.Error("failed to read spool segment", slog.String("segment", seg.path), sl.Err(err))
+		return s.fail(seg)
+	}
+
+	if len(events) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), s.insertTimeout)
+		err = s.sink.InsertClickEvents(ctx, events)
+		cancel()
+		if errors.Is(err, analytics.ErrRejected) {
+			s.log.Error("analytics sink rejected spooled click events", slog.String("segment", seg.path), sl.Err(err))
+			return s.fail(seg)
+		}
+		if err != nil {
+			s.log.Warn("analytics sink is still unavailable", sl.Err(err))
+			return false
+		}
+	}
+
+	if err := os.Remove(seg.path); err != nil {
+		// the segment would be inserted again
+		s.log.Error("failed to remove replayed spool segment", slog.String("segment", seg.path), sl.Err(err))
+		return false
+	}
+
+	s.advance(seg)
+
+	s.log.Info("replayed spooled click events", slog.Int("count", len(events)))
+
+	return true
+}
+
+// fail counts a replay of the oldest segment that can't succeed, after
+// maxAttempts of them the segment is quarantined. It reports whether the next
+// segment may be replayed right away.
+func (s *Spool) fail(seg segment) bool {
+	s.attempts++
+	if s.maxAttempts <= 0 || s.attempts < s.maxAttempts {
+		return false
+	}
+
+	path := seg.path + quarantineExt
+	if err := os.Rename(seg.path, path); err != nil {
+		s.log.Error("failed to quarantine spool segment", slog.String("segment", seg.path), sl.Err(err))
+		return false
+	}
+
+	s.log.Error("quarantined spool segment",
+		slog.String("segment", path),
+		slog.Int("attempts", s.attempts),
+	)
+	s.quarantined.Inc()
+	s.advance(seg)
+
+	s.mu.Lock()
+	s.failedSize += seg.size
+	s.failedBytes.Set(float64(s.failedSize))
+	s.mu.Unlock()
+
+	return true
+}
+
+// advance removes the oldest segment once it is replayed or quarantined.
+func (s *Spool) advance(seg segment) {
+	s.mu.Lock()
+	s.segments = s.segments[1:]
+	s.size -= seg.size
+	s.bytes.Set(float64(s.size))
+	s.mu.Unlock()
+
+	s.attempts = 0
+}
+
+// read decodes the events of a segment, a line cut short by a crash is
+// skipped.
+func (s *Spool) read(path string) ([]analytics.ClickEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var events []analytics.ClickEvent
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var event analytics.ClickEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			s.log.Warn("skipping malformed spooled click event", slog.String("segment", path), sl.Err(err))
+			continue
+		}
+		events = append(events, event)
+	}
+
+	return events, scanner.Err()
+}
+
+func (s *Spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, segmentExt))
+}
+
+// Close stops replaying, spooled events are replayed on the next start.
+func (s *Spool) Close(log *slog.Logger) {
+	close(s.stop)
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.rotate(); err != nil {
+		log.Error("could not close spool segment", sl.Err(err))
+	}
+}
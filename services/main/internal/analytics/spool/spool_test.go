@@ -0,0 +1,165 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/raisultan/url-shortener/services/main/internal/analytics"
+	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"github.com/raisultan/url-shortener/services/main/internal/metrics"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+type sink struct {
+	mu      sync.Mutex
+	down    bool
+	reject  string
+	aliases []string
+}
+
+func (s *sink) InsertClickEvents(_ context.Context, events []analytics.ClickEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.down {
+		return errors.New("unavailable")
+	}
+
+	for _, event := range events {
+		if event.URLAlias == s.reject {
+			return analytics.ErrRejected
+		}
+	}
+
+	for _, event := range events {
+		s.aliases = append(s.aliases, event.URLAlias)
+	}
+
+	return nil
+}
+
+func (s *sink) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+func (s *sink) inserted() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.aliases...)
+}
+
+func events(aliases ...string) []analytics.ClickEvent {
+	var res []analytics.ClickEvent
+	for _, alias := range aliases {
+		res = append(res, analytics.ClickEvent{URLAlias: alias, Timestamp: time.Now()})
+	}
+	return res
+}
+
+func TestSpool(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(httptest.NewRecorder(), nil))
+	cfg := config.Analytics{
+		InsertTimeout: time.Second,
+		Spool: config.Spool{
+			Dir:           t.TempDir(),
+			SegmentSize:   200,
+			MaxSize:       2000,
+			RetryInterval: time.Hour,
+		},
+	}
+	sink := &sink{down: true}
+	failures := metrics.AnalyticsInsertFailures.WithLabelValues("test")
+
+	s, err := New(log, "test", sink, cfg)
+	require.NoError(t, err)
+
+	require.NoError(t, s.InsertClickEvents(ctx, events("a", "b")))
+	s.replayAll()
+	require.Equal(t, 2.0, testutil.ToFloat64(failures), "failed replays are not counted again")
+	sink.setDown(false)
+	require.NoError(t, s.InsertClickEvents(ctx, events("c")), "spooled while older events wait")
+	require.Empty(t, sink.inserted())
+
+	require.ErrorIs(t, s.InsertClickEvents(ctx, events(make([]string, 20)...)), ErrFull)
+
+	// a restart picks up the spooled events
+	s.Close(log)
+	s, err = New(log, "test", sink, cfg)
+	require.NoError(t, err)
+	defer s.Close(log)
+
+	s.replayAll()
+	require.Equal(t, []string{"a", "b", "c"}, sink.inserted())
+
+	require.NoError(t, s.InsertClickEvents(ctx, events("d")))
+	require.Equal(t, []string{"a", "b", "c", "d"}, sink.inserted(), "inserted directly once the spool is empty")
+}
+
+func TestSpool_Quarantine(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(httptest.NewRecorder(), nil))
+	cfg := config.Analytics{
+		InsertTimeout: time.Second,
+		Spool: config.Spool{
+			Dir:           t.TempDir(),
+			SegmentSize:   1,
+			MaxSize:       2000,
+			RetryInterval: time.Hour,
+			MaxAttempts:   2,
+		},
+	}
+	sink := &sink{down: true, reject: "bad"}
+	quarantined := metrics.AnalyticsQuarantinedSegments.WithLabelValues("quarantine")
+
+	s, err := New(log, "quarantine", sink, cfg)
+	require.NoError(t, err)
+
+	// every insert is a segment of its own
+	for _, alias := range []string{"a", "bad", "b", "c"} {
+		require.NoError(t, s.InsertClickEvents(ctx, events(alias)))
+	}
+
+	for i := 0; i < cfg.Spool.MaxAttempts; i++ {
+		s.replayAll()
+	}
+	require.Empty(t, sink.inserted())
+	require.Equal(t, 0.0, testutil.ToFloat64(quarantined), "an unavailable sink doesn't fail segments")
+
+	sink.setDown(false)
+	s.replayAll()
+	require.Equal(t, []string{"a"}, sink.inserted(), "the rejected segment is retried")
+
+	s.replayAll()
+	require.Equal(t, []string{"a", "b", "c"}, sink.inserted(), "the rejected segment doesn't hold back the others")
+	require.Equal(t, 1.0, testutil.ToFloat64(quarantined))
+
+	failed, err := filepath.Glob(filepath.Join(cfg.Spool.Dir, "quarantine", "*"+segmentExt+quarantineExt))
+	require.NoError(t, err)
+	require.Len(t, failed, 1, "the rejected segment is kept")
+
+	// a restart keeps counting the quarantined segment toward the size limit
+	s.Close(log)
+	info, err := os.Stat(failed[0])
+	require.NoError(t, err)
+	cfg.Spool.MaxSize = info.Size()
+
+	s, err = New(log, "quarantine", sink, cfg)
+	require.NoError(t, err)
+	defer s.Close(log)
+
+	require.Greater(t, s.segmentPath(s.nextSeq), failed[0], "new segments follow the quarantined one")
+
+	sink.setDown(true)
+	require.ErrorIs(t, s.InsertClickEvents(ctx, events("d")), ErrFull)
+}
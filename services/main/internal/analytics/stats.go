@@ -0,0 +1,47 @@
+package analytics
+
+import "time"
+
+const (
+	GranularityHour = "hour"
+	GranularityDay  = "day"
+)
+
+// StatsFilter selects clicks of an alias in [From, To), zero times leave the
+// range open.
+type StatsFilter struct {
+	Workspace   string
+	Alias       string
+	From        time.Time
+	To          time.Time
+	Granularity string
+	// Top limits the number of values of every breakdown.
+	Top int
+	// IncludeBots counts clicks of bots as well.
+	IncludeBots bool
+}
+
+type Stats struct {
+	TotalClicks    uint64       `json:"total_clicks"`
+	UniqueVisitors uint64       `json:"unique_visitors"`
+	ErrorRate      float64      `json:"error_rate"`
+	Clicks         []TimeBucket `json:"clicks"`
+	TopReferrers   []Count      `json:"top_referrers"`
+	TopUserAgents  []Count      `json:"top_user_agents"`
+	// Devices, OperatingSystems and Browsers are empty for clicks recorded
+	// before user agents were parsed.
+	Devices          []Count `json:"devices"`
+	OperatingSystems []Count `json:"operating_systems"`
+	Browsers         []Count `json:"browsers"`
+}
+
+type TimeBucket struct {
+	Time           time.Time `json:"time"`
+	Clicks         uint64    `json:"clicks"`
+	UniqueVisitors uint64    `json:"unique_visitors"`
+}
+
+type Count struct {
+	Value  string `json:"value"`
+	Clicks uint64 `json:"clicks"`
+}
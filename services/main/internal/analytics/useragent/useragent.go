@@ -0,0 +1,69 @@
+// Package useragent tells the device, operating system and browser of a click
+// from its User-Agent header.
+package useragent
+
+import (
+	"strings"
+
+	"github.com/mssola/useragent"
+)
+
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+)
+
+type Client struct {
+	Device         string
+	OS             string
+	OSVersion      string
+	Browser        string
+	BrowserVersion string
+}
+
+// Parse describes the client of ua, an empty ua describes nothing.
+func Parse(ua string) Client {
+	if ua == "" {
+		return Client{}
+	}
+
+	parsed := useragent.New(ua)
+	os := parsed.OSInfo()
+	browser, browserVersion := parsed.Browser()
+
+	return Client{
+		Device:         device(parsed, ua),
+		OS:             os.Name,
+		OSVersion:      os.Version,
+		Browser:        browser,
+		BrowserVersion: browserVersion,
+	}
+}
+
+func device(parsed *useragent.UserAgent, ua string) string {
+	switch {
+	case parsed.Bot():
+		return DeviceBot
+	case isTablet(ua):
+		return DeviceTablet
+	case parsed.Mobile():
+		return DeviceMobile
+	default:
+		return DeviceDesktop
+	}
+}
+
+// isTablet recognizes iPads and Android devices that don't claim to be
+// mobile, as Android phones do.
+func isTablet(ua string) bool {
+	switch {
+	case strings.Contains(ua, "iPad"), strings.Contains(ua, "Tablet"):
+		return true
+	case strings.Contains(ua, "Android"):
+		return !strings.Contains(ua, "Mobile")
+	default:
+		return false
+	}
+}
@@ -0,0 +1,48 @@
+package useragent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		ua   string
+		want Client
+	}{
+		{
+			ua: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36",
+			want: Client{
+				Device: DeviceDesktop, OS: "Windows", OSVersion: "10",
+				Browser: "Chrome", BrowserVersion: "119.0.0.0",
+			},
+		},
+		{
+			ua: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+			want: Client{
+				Device: DeviceMobile, OS: "iPhone OS", OSVersion: "17.1",
+				Browser: "Safari", BrowserVersion: "17.1",
+			},
+		},
+		{
+			ua: "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36",
+			want: Client{
+				Device: DeviceTablet, OS: "Android", OSVersion: "13",
+				Browser: "Chrome", BrowserVersion: "119.0.0.0",
+			},
+		},
+		{
+			ua:   "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: Client{Device: DeviceBot, Browser: "Googlebot", BrowserVersion: "2.1"},
+		},
+		{
+			ua:   "",
+			want: Client{},
+		},
+	}
+
+	for _, tc := range cases {
+		require.Equal(t, tc.want, Parse(tc.ua), tc.ua)
+	}
+}
@@ -0,0 +1,82 @@
+// Package webhook posts click events to an HTTP endpoint.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/raisultan/url-shortener/services/main/internal/analytics"
+	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+type Request struct {
+	Events []analytics.ClickEvent `json:"events"`
+}
+
+type Sink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func New(cfg config.WebhookSink) *Sink {
+	return &Sink{
+		url:     cfg.URL,
+		headers: cfg.Headers,
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+	}
+}
+
+// InsertClickEvents posts the batch as {"events": [...]}, any status but 2xx
+// fails the batch. Client errors other than timeouts and rate limits reject
+// the events.
+func (s *Sink) InsertClickEvents(ctx context.Context, events []analytics.ClickEvent) error {
+	const op = "analytics.webhook.InsertClickEvents"
+
+	body, err := json.Marshal(Request{Events: events})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if rejected(resp.StatusCode) {
+		return fmt.Errorf("%s: %w: status %d", op, analytics.ErrRejected, resp.StatusCode)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: unexpected status %d", op, resp.StatusCode)
+	}
+
+	return nil
+}
+
+func rejected(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+
+	return code >= 400 && code < 500
+}
@@ -0,0 +1,85 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/raisultan/url-shortener/lib/http-server/middleware/auth"
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+)
+
+const keySize = 32
+
+type KeyGetter interface {
+	GetAPIKey(ctx context.Context, hash string) (storage.APIKey, error)
+}
+
+type KeySaver interface {
+	SaveAPIKey(ctx context.Context, key storage.APIKey) error
+}
+
+// Resolver resolves API keys stored in the url storage for the auth middleware.
+type Resolver struct {
+	keys   KeyGetter
+	admins map[string]bool
+}
+
+// NewResolver makes admins of the keys listed as "workspace/name" in admins.
+func NewResolver(keys KeyGetter, admins []string) *Resolver {
+	r := &Resolver{keys: keys, admins: make(map[string]bool, len(admins))}
+	for _, admin := range admins {
+		r.admins[admin] = true
+	}
+
+	return r
+}
+
+func (r *Resolver) ResolveKey(ctx context.Context, hash string) (auth.Principal, error) {
+	const op = "apikey.ResolveKey"
+
+	key, err := r.keys.GetAPIKey(ctx, hash)
+	if errors.Is(err, storage.ErrAPIKeyNotFound) {
+		return auth.Principal{}, auth.ErrKeyNotFound
+	}
+	if err != nil {
+		return auth.Principal{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return auth.Principal{
+		Name:      key.Name,
+		Workspace: key.Workspace,
+		Admin:     r.admins[key.Workspace+"/"+key.Name],
+	}, nil
+}
+
+// Create generates a new key for the named client of the workspace and stores
+// its hash, the key itself is returned once and can't be recovered later.
+func Create(ctx context.Context, keys KeySaver, name string, workspace string) (string, error) {
+	const op = "apikey.Create"
+
+	if name == "" {
+		return "", fmt.Errorf("%s: name is empty", op)
+	}
+
+	b := make([]byte, keySize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	key := base64.RawURLEncoding.EncodeToString(b)
+
+	err := keys.SaveAPIKey(ctx, storage.APIKey{
+		Hash:      auth.HashKey(key),
+		Name:      name,
+		Workspace: workspace,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return key, nil
+}
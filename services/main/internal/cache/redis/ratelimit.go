@@ -0,0 +1,68 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/raisultan/url-shortener/lib/http-server/middleware/ratelimit"
+)
+
+// tokenBucket refills the bucket stored as a hash under KEYS[1] with ARGV[1]
+// tokens per millisecond up to ARGV[2] tokens and takes one token from it.
+// It returns whether the token was taken and the milliseconds until the next
+// one is available. The time is taken from the server, so instances with
+// skewed clocks share the same buckets. Numbers are stored as strings as Lua
+// numbers passed to Redis are truncated to integers.
+var tokenBucket = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(bucket[1]) or capacity
+local updated = tonumber(bucket[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * rate)
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate))
+
+return {allowed, wait}
+`)
+
+// Allow takes a token from the bucket shared by all instances.
+func (c *Cache) Allow(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	const op = "cache.redis.Allow"
+
+	perMillisecond := limit.PerSecond() / float64(time.Second/time.Millisecond)
+	res, err := tokenBucket.Run(
+		ctx,
+		c.client,
+		[]string{key},
+		strconv.FormatFloat(perMillisecond, 'g', -1, 64),
+		limit.Capacity(),
+	).Int64Slice()
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("%s: could not take token %w", op, err)
+	}
+	if len(res) != 2 {
+		return ratelimit.Result{}, fmt.Errorf("%s: unexpected script result %v", op, res)
+	}
+
+	return ratelimit.Result{
+		Allowed:    res[0] == 1,
+		RetryAfter: time.Duration(res[1]) * time.Millisecond,
+	}, nil
+}
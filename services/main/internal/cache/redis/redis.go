@@ -2,16 +2,27 @@ package redis
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-redis/redis/v8"
 	"github.com/raisultan/url-shortener/lib/logger/sl"
 	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"github.com/raisultan/url-shortener/services/main/internal/metrics"
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
 	"golang.org/x/exp/slog"
 	"time"
 )
 
 const urlTTL = 24 * time.Hour
 
+// domainTTL bounds how long a host resolves to a domain changed without the
+// API, handlers drop cached domains they change.
+const domainTTL = 10 * time.Minute
+
+// scanCount is the number of keys DeleteHost asks for and deletes at once.
+const scanCount = 100
+
 type Cache struct {
 	client *redis.Client
 }
@@ -25,6 +36,7 @@ func New(config config.Cache, ctx context.Context) (*Cache, error) {
 	}
 
 	client := redis.NewClient(options)
+	client.AddHook(tracingHook{})
 	_, err = client.Ping(ctx).Result()
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
@@ -33,6 +45,16 @@ func New(config config.Cache, ctx context.Context) (*Cache, error) {
 	return &Cache{client}, nil
 }
 
+func (c *Cache) Ping(ctx context.Context) error {
+	const op = "cache.redis.Ping"
+
+	if err := c.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
 func (c *Cache) Close(log *slog.Logger) {
 	err := c.client.Close()
 	if err != nil {
@@ -40,35 +62,191 @@ func (c *Cache) Close(log *slog.Logger) {
 	}
 }
 
-func (c *Cache) SaveUrl(ctx context.Context, urlToSave string, alias string) error {
+// SaveUrl caches the link under every host it is served on for urlTTL, or
+// until it expires if that comes earlier. Already expired links are not cached.
+func (c *Cache) SaveUrl(ctx context.Context, hosts []string, link storage.Link) error {
 	const op = "cache.redis.SaveUrl"
 
-	err := c.client.Set(ctx, alias, urlToSave, urlTTL).Err()
+	err := c.SaveUrls(ctx, hosts, []storage.Link{link})
 	if err != nil {
-		return fmt.Errorf("%s: could not save url to cache %w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
 
-func (c *Cache) GetUrl(ctx context.Context, alias string) (string, error) {
+// SaveUrls caches links with a single round trip, see SaveUrl.
+func (c *Cache) SaveUrls(ctx context.Context, hosts []string, links []storage.Link) error {
+	const op = "cache.redis.SaveUrls"
+
+	pipe := c.client.Pipeline()
+	for _, link := range links {
+		ttl, ok := linkTTL(link)
+		if !ok {
+			continue
+		}
+
+		data, err := json.Marshal(link)
+		if err != nil {
+			return fmt.Errorf("%s: could not encode link %w", op, err)
+		}
+
+		for _, host := range hosts {
+			pipe.Set(ctx, key(host, link.Alias), data, ttl)
+		}
+	}
+
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: could not save urls to cache %w", op, err)
+	}
+
+	return nil
+}
+
+// linkTTL caps urlTTL with the link expiration, it reports false for
+// already expired links.
+func linkTTL(link storage.Link) (time.Duration, bool) {
+	if link.ExpiresAt.IsZero() {
+		return urlTTL, true
+	}
+
+	untilExpiry := time.Until(link.ExpiresAt)
+	if untilExpiry <= 0 {
+		return 0, false
+	}
+
+	return min(untilExpiry, urlTTL), true
+}
+
+// key scopes the alias to the host it is served on, the same alias may exist
+// on several hosts.
+func key(host string, alias string) string {
+	return host + "/" + alias
+}
+
+func (c *Cache) GetUrl(ctx context.Context, host string, alias string) (storage.Link, error) {
 	const op = "cache.redis.GetUrl"
 
-	url, err := c.client.Get(ctx, alias).Result()
+	data, err := c.client.Get(ctx, key(host, alias)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		metrics.CacheRequests.WithLabelValues("miss").Inc()
+	} else if err != nil {
+		metrics.CacheRequests.WithLabelValues("error").Inc()
+	} else {
+		metrics.CacheRequests.WithLabelValues("hit").Inc()
+	}
 	if err != nil {
-		return "", fmt.Errorf("%s: could not generate url from cache %w", op, err)
+		return storage.Link{}, fmt.Errorf("%s: could not generate url from cache %w", op, err)
 	}
 
-	return url, nil
+	var link storage.Link
+	err = json.Unmarshal(data, &link)
+	if err != nil {
+		return storage.Link{}, fmt.Errorf("%s: could not decode link %w", op, err)
+	}
+
+	return link, nil
 }
 
-func (c *Cache) DeleteUrl(ctx context.Context, alias string) error {
+func (c *Cache) DeleteUrl(ctx context.Context, hosts []string, alias string) error {
 	const op = "cache.redis.DeleteUrl"
 
-	err := c.client.Del(ctx, alias).Err()
+	if len(hosts) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		keys = append(keys, key(host, alias))
+	}
+
+	err := c.client.Del(ctx, keys...).Err()
 	if err != nil {
 		return fmt.Errorf("%s: could not delete url from cache %w", op, err)
 	}
 
 	return nil
 }
+
+// SaveDomain caches the domain under its host, a domain without a workspace
+// records that the host is not registered.
+func (c *Cache) SaveDomain(ctx context.Context, domain storage.Domain) error {
+	const op = "cache.redis.SaveDomain"
+
+	data, err := json.Marshal(domain)
+	if err != nil {
+		return fmt.Errorf("%s: could not encode domain %w", op, err)
+	}
+
+	err = c.client.Set(ctx, domainKey(domain.Host), data, domainTTL).Err()
+	if err != nil {
+		return fmt.Errorf("%s: could not save domain to cache %w", op, err)
+	}
+
+	return nil
+}
+
+func (c *Cache) GetDomain(ctx context.Context, host string) (storage.Domain, error) {
+	const op = "cache.redis.GetDomain"
+
+	data, err := c.client.Get(ctx, domainKey(host)).Bytes()
+	if err != nil {
+		return storage.Domain{}, fmt.Errorf("%s: could not get domain from cache %w", op, err)
+	}
+
+	var domain storage.Domain
+	err = json.Unmarshal(data, &domain)
+	if err != nil {
+		return storage.Domain{}, fmt.Errorf("%s: could not decode domain %w", op, err)
+	}
+
+	return domain, nil
+}
+
+func (c *Cache) DeleteDomain(ctx context.Context, host string) error {
+	const op = "cache.redis.DeleteDomain"
+
+	err := c.client.Del(ctx, domainKey(host)).Err()
+	if err != nil {
+		return fmt.Errorf("%s: could not delete domain from cache %w", op, err)
+	}
+
+	return nil
+}
+
+// domainKey can't collide with link keys, hosts have no colons.
+func domainKey(host string) string {
+	return "domain:" + host
+}
+
+// DeleteHost drops every link cached under the host, links of a host are
+// stale once it is bound to another workspace.
+func (c *Cache) DeleteHost(ctx context.Context, host string) error {
+	const op = "cache.redis.DeleteHost"
+
+	iter := c.client.Scan(ctx, 0, key(host, "*"), scanCount).Iterator()
+	keys := make([]string, 0, scanCount)
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) < scanCount {
+			continue
+		}
+
+		if err := c.client.Del(ctx, keys...).Err(); err != nil {
+			return fmt.Errorf("%s: could not delete urls from cache %w", op, err)
+		}
+		keys = keys[:0]
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("%s: could not scan cache %w", op, err)
+	}
+
+	if len(keys) > 0 {
+		if err := c.client.Del(ctx, keys...).Err(); err != nil {
+			return fmt.Errorf("%s: could not delete urls from cache %w", op, err)
+		}
+	}
+
+	return nil
+}
@@ -2,8 +2,10 @@ package config
 
 import (
 	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/raisultan/url-shortener/lib/tracing"
 	"log"
 	"os"
+	"slices"
 	"time"
 )
 
@@ -15,6 +17,10 @@ type Config struct {
 	Cache          `yaml:"cache"`
 	AliasGenerator `yaml:"alias_generator"`
 	ClickHouse     `yaml:"clickhouse"`
+	Analytics      `yaml:"analytics"`
+	RateLimit      `yaml:"rate_limit"`
+	Auth           `yaml:"auth"`
+	Tracing        tracing.Config `yaml:"tracing"`
 }
 
 type HttpServer struct {
@@ -22,6 +28,45 @@ type HttpServer struct {
 	Timeout     time.Duration `yaml:"timeout" env-default:"3s"`
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
 	CtxTimeout  time.Duration `yaml:"ctx_timeout" env-default:"8s"`
+	// ShutdownDelay keeps serving requests after readiness starts failing on
+	// shutdown, until load balancers take the instance out.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" env-default:"5s"`
+	// MetricsAddress serves Prometheus metrics apart from the API, so they
+	// are not exposed with it.
+	MetricsAddress string `yaml:"metrics_address" env-default:"localhost:9090"`
+	// HealthTimeout limits every dependency check of the readiness probe.
+	HealthTimeout time.Duration `yaml:"health_timeout" env-default:"1s"`
+	// DefaultDomain serves requests to hosts that are not registered as domains.
+	DefaultDomain string `yaml:"default_domain"`
+	// TrustedProxies lists CIDRs and addresses of proxies whose forwarding
+	// headers name the client of a request.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// Auth lists Admins, API keys named as "workspace/name" that may change links
+// of any owner in their workspace. Links created before API keys were
+// required have no owner and can only be changed by admins.
+type Auth struct {
+	Admins []string `yaml:"admins"`
+}
+
+// RateLimit holds limits of routes named as "METHOD /pattern", routes that
+// are not listed are not limited.
+type RateLimit struct {
+	Routes map[string]RouteRateLimit `yaml:"routes"`
+}
+
+type RouteRateLimit struct {
+	PerKey RateLimitRule `yaml:"per_key"`
+	PerIP  RateLimitRule `yaml:"per_ip"`
+}
+
+// RateLimitRule allows Rate requests per Period with bursts of up to Burst
+// requests, Burst defaults to Rate.
+type RateLimitRule struct {
+	Rate   int           `yaml:"rate"`
+	Period time.Duration `yaml:"period"`
+	Burst  int           `yaml:"burst"`
 }
 
 type AliasGenerator struct {
@@ -29,14 +74,81 @@ type AliasGenerator struct {
 	Timeout time.Duration `yaml:"timeout" env-default:"3s"`
 }
 
+// ClickHouse is only used by the clickhouse analytics sink, Dsn is required
+// while it is enabled.
 type ClickHouse struct {
-	Dsn      string `yaml:"dsn" env-required:"true"`
+	Dsn      string `yaml:"dsn"`
 	Database string `yaml:"database" env-default:"testing"`
+	// TolerateUnavailable starts the service while ClickHouse is down, click
+	// events wait in the spool until it is up.
+	TolerateUnavailable bool          `yaml:"tolerate_unavailable"`
+	StartTimeout        time.Duration `yaml:"start_timeout" env-default:"5s"`
+}
+
+// Analytics buffers click events of every sink in a queue of QueueSize events
+// and inserts them in batches of up to BatchSize events at least every
+// FlushInterval.
+type Analytics struct {
+	// Sinks lists the enabled sinks: clickhouse, file, stdout and webhook.
+	Sinks   []string    `yaml:"sinks" env-default:"clickhouse"`
+	File    FileSink    `yaml:"file"`
+	Webhook WebhookSink `yaml:"webhook"`
+
+	QueueSize     int           `yaml:"queue_size" env-default:"10000"`
+	BatchSize     int           `yaml:"batch_size" env-default:"1000"`
+	FlushInterval time.Duration `yaml:"flush_interval" env-default:"1s"`
+	InsertTimeout time.Duration `yaml:"insert_timeout" env-default:"5s"`
+	// Backpressure is what happens to events while the queue is full: drop
+	// drops them, block makes redirects wait for room in the queue.
+	Backpressure string  `yaml:"backpressure" env-default:"drop"`
+	Spool        Spool   `yaml:"spool"`
+	Privacy      Privacy `yaml:"privacy"`
+	GeoIP        GeoIP   `yaml:"geoip"`
+}
+
+// GeoIP locates clicks in the MaxMind-format Databases, they are checked for
+// changes every CheckInterval. Clicks are not located without databases.
+type GeoIP struct {
+	Databases     []string      `yaml:"databases"`
+	CheckInterval time.Duration `yaml:"check_interval" env-default:"1m"`
+}
+
+// Privacy controls personal data kept of clicks. IPMode is full, truncate or
+// drop, VisitorSalt is the secret visitor hashes are keyed with.
+type Privacy struct {
+	IPMode      string `yaml:"ip_mode" env-default:"truncate"`
+	VisitorSalt string `yaml:"visitor_salt" env:"ANALYTICS_VISITOR_SALT"`
+}
+
+type FileSink struct {
+	Path string `yaml:"path" env-default:"./storage/clicks.jsonl"`
+}
+
+// WebhookSink posts batches of click events to URL with Headers.
+type WebhookSink struct {
+	URL     string            `yaml:"url"`
+	Timeout time.Duration     `yaml:"timeout" env-default:"5s"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+// Spool keeps click events a sink failed to take in a directory per sink
+// under Dir, up to MaxSize bytes per sink in segments of SegmentSize bytes,
+// and tries to replay them every RetryInterval. A segment the sink rejects
+// MaxAttempts times is quarantined, zero retries it forever. An empty Dir
+// disables the spool.
+type Spool struct {
+	Dir           string        `yaml:"dir"`
+	SegmentSize   int64         `yaml:"segment_size" env-default:"4194304"`
+	MaxSize       int64         `yaml:"max_size" env-default:"1073741824"`
+	RetryInterval time.Duration `yaml:"retry_interval" env-default:"5s"`
+	MaxAttempts   int           `yaml:"max_attempts" env-default:"10"`
 }
 
 type Storages struct {
-	SQLite SQLiteConfig `yaml:"sqlite"`
-	Mongo  MongoConfig  `yaml:"mongo"`
+	SQLite   SQLiteConfig   `yaml:"sqlite"`
+	Mongo    MongoConfig    `yaml:"mongo"`
+	Postgres PostgresConfig `yaml:"postgres"`
+	Memory   MemoryConfig   `yaml:"memory"`
 }
 
 type Cache struct {
@@ -44,13 +156,35 @@ type Cache struct {
 }
 
 type SQLiteConfig struct {
-	StoragePath string `yaml:"storage_path" env-required:"true"`
+	StoragePath string `yaml:"storage_path"`
 }
 
 type MongoConfig struct {
-	URI        string `yaml:"uri" env-required:"true"`
+	URI        string `yaml:"uri"`
 	Database   string `yaml:"database" env-default:"url-db"`
 	Collection string `yaml:"collection" env-default:"urls"`
+	// HistoryCollection keeps previous destinations of updated urls.
+	HistoryCollection    string `yaml:"history_collection" env-default:"url_history"`
+	APIKeysCollection    string `yaml:"api_keys_collection" env-default:"api_keys"`
+	WorkspacesCollection string `yaml:"workspaces_collection" env-default:"workspaces"`
+	DomainsCollection    string `yaml:"domains_collection" env-default:"domains"`
+}
+
+type PostgresConfig struct {
+	Host            string        `yaml:"host" env-default:"localhost"`
+	Port            int           `yaml:"port" env-default:"5432"`
+	User            string        `yaml:"user" env-default:"url-shortener"`
+	Password        string        `yaml:"password" env-default:"url-shortener"`
+	DBName          string        `yaml:"dbname" env-default:"url-shortener"`
+	SSLMode         string        `yaml:"sslmode" env-default:"disable"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env-default:"25"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env-default:"25"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env-default:"5m"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env-default:"1m"`
+}
+
+type MemoryConfig struct {
+	SnapshotPath string `yaml:"snapshot_path"`
 }
 
 func MustLoadConfig() *Config {
@@ -68,5 +202,9 @@ func MustLoadConfig() *Config {
 		log.Fatalf("cannot read config: %s", err)
 	}
 
+	if slices.Contains(cfg.Analytics.Sinks, "clickhouse") && cfg.ClickHouse.Dsn == "" {
+		log.Fatal("clickhouse.dsn is required by the clickhouse analytics sink")
+	}
+
 	return &cfg
 }
@@ -0,0 +1,138 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+)
+
+type HostCache interface {
+	SaveUrls(ctx context.Context, hosts []string, links []storage.Link) error
+	GetUrl(ctx context.Context, host string, alias string) (storage.Link, error)
+	DeleteUrl(ctx context.Context, hosts []string, alias string) error
+	DeleteHost(ctx context.Context, host string) error
+	DeleteDomain(ctx context.Context, host string) error
+}
+
+// Cache keeps links under every host of their workspace, so handlers that
+// know only the workspace of a link can cache and invalidate it.
+type Cache struct {
+	cache    HostCache
+	resolver *Resolver
+}
+
+func NewCache(cache HostCache, resolver *Resolver) *Cache {
+	return &Cache{cache: cache, resolver: resolver}
+}
+
+func (c *Cache) SaveUrl(ctx context.Context, link storage.Link) error {
+	return c.SaveUrls(ctx, []storage.Link{link})
+}
+
+func (c *Cache) SaveUrls(ctx context.Context, links []storage.Link) error {
+	const op = "domain.Cache.SaveUrls"
+
+	byWorkspace := make(map[string][]storage.Link)
+	for _, link := range links {
+		byWorkspace[link.Workspace] = append(byWorkspace[link.Workspace], link)
+	}
+
+	for workspace, links := range byWorkspace {
+		hosts, err := c.resolver.Hosts(ctx, workspace)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := c.cache.SaveUrls(ctx, hosts, links); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Cache) GetUrl(ctx context.Context, host string, alias string) (storage.Link, error) {
+	return c.cache.GetUrl(ctx, host, alias)
+}
+
+func (c *Cache) DeleteUrl(ctx context.Context, workspace string, alias string) error {
+	const op = "domain.Cache.DeleteUrl"
+
+	hosts, err := c.resolver.Hosts(ctx, workspace)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := c.cache.DeleteUrl(ctx, hosts, alias); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteHost drops the cached domain of the host and links cached under it,
+// they are stale once the host is bound to another workspace.
+func (c *Cache) DeleteHost(ctx context.Context, host string) error {
+	const op = "domain.Cache.DeleteHost"
+
+	host = storage.Host(host)
+
+	if err := c.cache.DeleteDomain(ctx, host); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := c.cache.DeleteHost(ctx, host); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+type DomainCache interface {
+	SaveDomain(ctx context.Context, domain storage.Domain) error
+	GetDomain(ctx context.Context, host string) (storage.Domain, error)
+}
+
+// CachedDomains caches the domain of every host looked up, and that a host is
+// not registered, so redirects resolve their host without querying storage.
+type CachedDomains struct {
+	domains DomainStorage
+	cache   DomainCache
+}
+
+func NewCachedDomains(domains DomainStorage, cache DomainCache) *CachedDomains {
+	return &CachedDomains{domains: domains, cache: cache}
+}
+
+// GetDomain falls back to storage if the cache fails, a failure to cache the
+// domain doesn't fail the lookup.
+func (c *CachedDomains) GetDomain(ctx context.Context, host string) (storage.Domain, error) {
+	const op = "domain.CachedDomains.GetDomain"
+
+	domain, err := c.cache.GetDomain(ctx, host)
+	if err == nil && domain.Workspace == "" {
+		return storage.Domain{}, storage.ErrDomainNotFound
+	}
+	if err == nil {
+		return domain, nil
+	}
+
+	domain, err = c.domains.GetDomain(ctx, host)
+	if errors.Is(err, storage.ErrDomainNotFound) {
+		_ = c.cache.SaveDomain(ctx, storage.Domain{Host: host})
+		return storage.Domain{}, err
+	}
+	if err != nil {
+		return storage.Domain{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_ = c.cache.SaveDomain(ctx, domain)
+
+	return domain, nil
+}
+
+func (c *CachedDomains) ListDomains(ctx context.Context, workspace string) ([]storage.Domain, error) {
+	return c.domains.ListDomains(ctx, workspace)
+}
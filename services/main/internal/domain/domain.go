@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+)
+
+type DomainStorage interface {
+	GetDomain(ctx context.Context, host string) (storage.Domain, error)
+	ListDomains(ctx context.Context, workspace string) ([]storage.Domain, error)
+}
+
+// Resolver maps request hosts to registered domains. Hosts that aren't
+// registered are served as the default domain, which belongs to the default
+// workspace unless it is registered to another one.
+type Resolver struct {
+	domains       DomainStorage
+	defaultDomain string
+}
+
+func NewResolver(domains DomainStorage, defaultDomain string) *Resolver {
+	return &Resolver{domains: domains, defaultDomain: storage.Host(defaultDomain)}
+}
+
+// Resolve returns the domain the host is served as.
+func (r *Resolver) Resolve(ctx context.Context, host string) (storage.Domain, error) {
+	const op = "domain.Resolve"
+
+	domain, err := r.domains.GetDomain(ctx, storage.Host(host))
+	if errors.Is(err, storage.ErrDomainNotFound) {
+		domain, err = r.fallback(ctx)
+	}
+	if err != nil {
+		return storage.Domain{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return domain, nil
+}
+
+// Hosts returns the hosts links of the workspace are served on.
+func (r *Resolver) Hosts(ctx context.Context, workspace string) ([]string, error) {
+	const op = "domain.Hosts"
+
+	domains, err := r.domains.ListDomains(ctx, workspace)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	hosts := make([]string, 0, len(domains)+1)
+	for _, domain := range domains {
+		hosts = append(hosts, domain.Host)
+	}
+
+	fallback, err := r.fallback(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if fallback.Workspace == workspace && !slices.Contains(hosts, fallback.Host) {
+		hosts = append(hosts, fallback.Host)
+	}
+
+	return hosts, nil
+}
+
+func (r *Resolver) fallback(ctx context.Context) (storage.Domain, error) {
+	if r.defaultDomain == "" {
+		return storage.Domain{Workspace: storage.DefaultWorkspace}, nil
+	}
+
+	domain, err := r.domains.GetDomain(ctx, r.defaultDomain)
+	if errors.Is(err, storage.ErrDomainNotFound) {
+		return storage.Domain{Host: r.defaultDomain, Workspace: storage.DefaultWorkspace}, nil
+	}
+
+	return domain, err
+}
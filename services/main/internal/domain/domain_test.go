@@ -0,0 +1,139 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+	"github.com/raisultan/url-shortener/services/main/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolver(t *testing.T) {
+	ctx := context.Background()
+	s, err := memory.New(config.Storages{}, ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, s.SaveWorkspace(ctx, storage.Workspace{ID: "brand"}))
+	require.NoError(t, s.SaveDomain(ctx, storage.Domain{Host: "go.brand.com", Workspace: "brand"}))
+
+	tests := []struct {
+		name          string
+		defaultDomain string
+		host          string
+		want          storage.Domain
+	}{
+		{
+			name: "registered host",
+			host: "GO.brand.com:443",
+			want: storage.Domain{Host: "go.brand.com", Workspace: "brand"},
+		},
+		{
+			name: "unknown host",
+			host: "localhost:8080",
+			want: storage.Domain{Workspace: storage.DefaultWorkspace},
+		},
+		{
+			name:          "unknown host with default domain",
+			defaultDomain: "Short.example",
+			host:          "localhost:8080",
+			want:          storage.Domain{Host: "short.example", Workspace: storage.DefaultWorkspace},
+		},
+		{
+			name:          "registered default domain",
+			defaultDomain: "go.brand.com",
+			host:          "localhost:8080",
+			want:          storage.Domain{Host: "go.brand.com", Workspace: "brand"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewResolver(s, tt.defaultDomain).Resolve(ctx, tt.host)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestResolver_Hosts(t *testing.T) {
+	ctx := context.Background()
+	s, err := memory.New(config.Storages{}, ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, s.SaveWorkspace(ctx, storage.Workspace{ID: "brand"}))
+	require.NoError(t, s.SaveDomain(ctx, storage.Domain{Host: "go.brand.com", Workspace: "brand"}))
+
+	r := NewResolver(s, "short.example")
+
+	hosts, err := r.Hosts(ctx, "brand")
+	require.NoError(t, err)
+	require.Equal(t, []string{"go.brand.com"}, hosts)
+
+	hosts, err = r.Hosts(ctx, storage.DefaultWorkspace)
+	require.NoError(t, err)
+	require.Equal(t, []string{"short.example"}, hosts)
+
+	hosts, err = NewResolver(s, "go.brand.com").Hosts(ctx, storage.DefaultWorkspace)
+	require.NoError(t, err)
+	require.Empty(t, hosts, "the default domain serves another workspace")
+}
+
+type countingDomains struct {
+	DomainStorage
+	lookups int
+}
+
+func (c *countingDomains) GetDomain(ctx context.Context, host string) (storage.Domain, error) {
+	c.lookups++
+	return c.DomainStorage.GetDomain(ctx, host)
+}
+
+type domainCache map[string]storage.Domain
+
+func (c domainCache) SaveDomain(_ context.Context, domain storage.Domain) error {
+	c[domain.Host] = domain
+	return nil
+}
+
+func (c domainCache) GetDomain(_ context.Context, host string) (storage.Domain, error) {
+	domain, ok := c[host]
+	if !ok {
+		return storage.Domain{}, errors.New("miss")
+	}
+	return domain, nil
+}
+
+func TestCachedDomains(t *testing.T) {
+	ctx := context.Background()
+	s, err := memory.New(config.Storages{}, ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, s.SaveWorkspace(ctx, storage.Workspace{ID: "brand"}))
+	require.NoError(t, s.SaveDomain(ctx, storage.Domain{Host: "go.brand.com", Workspace: "brand"}))
+
+	domains := &countingDomains{DomainStorage: s}
+	cache := domainCache{}
+	r := NewResolver(NewCachedDomains(domains, cache), "short.example")
+
+	for i := 0; i < 2; i++ {
+		got, err := r.Resolve(ctx, "go.brand.com")
+		require.NoError(t, err)
+		require.Equal(t, "brand", got.Workspace)
+
+		got, err = r.Resolve(ctx, "localhost")
+		require.NoError(t, err)
+		require.Equal(t, storage.DefaultWorkspace, got.Workspace)
+	}
+	require.Equal(t, 3, domains.lookups, "hosts and the default domain are looked up once")
+
+	// the domain handlers drop the cached domain of a host they bind
+	require.NoError(t, s.SaveDomain(ctx, storage.Domain{Host: "localhost", Workspace: "brand"}))
+	delete(cache, "localhost")
+
+	got, err := r.Resolve(ctx, "localhost")
+	require.NoError(t, err)
+	require.Equal(t, "brand", got.Workspace)
+}
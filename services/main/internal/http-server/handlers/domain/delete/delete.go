@@ -0,0 +1,64 @@
+package delete
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/raisultan/url-shortener/lib/api/response"
+	"github.com/raisultan/url-shortener/lib/http-server/middleware/auth"
+	"github.com/raisultan/url-shortener/lib/logger/sl"
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+	"golang.org/x/exp/slog"
+)
+
+type DomainDeleter interface {
+	DeleteDomain(ctx context.Context, workspace string, host string) error
+}
+
+type HostDeleterCache interface {
+	DeleteHost(ctx context.Context, host string) error
+}
+
+func New(log *slog.Logger, domainDeleter DomainDeleter, hostDeleterCache HostDeleterCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.domain.delete.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		principal, _ := auth.PrincipalFromContext(r.Context())
+
+		host := chi.URLParam(r, "host")
+		// URLFormat middleware takes the top-level domain for a format extension
+		if format, _ := r.Context().Value(middleware.URLFormatCtxKey).(string); format != "" {
+			host += "." + format
+		}
+		host = storage.Host(host)
+
+		err := domainDeleter.DeleteDomain(r.Context(), principal.Workspace, host)
+		if errors.Is(err, storage.ErrDomainNotFound) {
+			log.Info("domain not found", slog.String("host", host))
+			response.Problem(w, r, http.StatusNotFound, response.Error("domain not found"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to delete domain", sl.Err(err))
+			response.Problem(w, r, http.StatusInternalServerError, response.Error("failed to delete domain"))
+			return
+		}
+
+		err = hostDeleterCache.DeleteHost(r.Context(), host)
+		if err != nil {
+			log.Error("failed to delete host from cache", sl.Err(err))
+		}
+
+		log.Info("domain deleted", slog.String("host", host))
+		render.JSON(w, r, response.OK())
+	}
+}
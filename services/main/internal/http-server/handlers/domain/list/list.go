@@ -0,0 +1,49 @@
+package list
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/raisultan/url-shortener/lib/api/response"
+	"github.com/raisultan/url-shortener/lib/http-server/middleware/auth"
+	"github.com/raisultan/url-shortener/lib/logger/sl"
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+	"golang.org/x/exp/slog"
+)
+
+type Response struct {
+	response.Response
+	Domains []storage.Domain `json:"domains"`
+}
+
+type DomainLister interface {
+	ListDomains(ctx context.Context, workspace string) ([]storage.Domain, error)
+}
+
+func New(log *slog.Logger, domainLister DomainLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.domain.list.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		principal, _ := auth.PrincipalFromContext(r.Context())
+
+		domains, err := domainLister.ListDomains(r.Context(), principal.Workspace)
+		if err != nil {
+			log.Error("failed to list domains", sl.Err(err))
+			response.Problem(w, r, http.StatusInternalServerError, response.Error("failed to list domains"))
+			return
+		}
+
+		log.Info("domains listed", slog.Int("count", len(domains)))
+		render.JSON(w, r, Response{
+			Response: response.OK(),
+			Domains:  domains,
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package save
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/raisultan/url-shortener/lib/api/response"
+	"github.com/raisultan/url-shortener/lib/http-server/middleware/auth"
+	"github.com/raisultan/url-shortener/lib/logger/sl"
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+	"golang.org/x/exp/slog"
+)
+
+type Request struct {
+	Host string `json:"host" validate:"required,hostname_rfc1123"`
+}
+
+type Response struct {
+	response.Response
+	Domain *storage.Domain `json:"domain,omitempty"`
+}
+
+type DomainSaver interface {
+	SaveDomain(ctx context.Context, domain storage.Domain) error
+}
+
+type HostDeleterCache interface {
+	DeleteHost(ctx context.Context, host string) error
+}
+
+func New(log *slog.Logger, domainSaver DomainSaver, hostDeleterCache HostDeleterCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.domain.save.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req Request
+		err := render.DecodeJSON(r.Body, &req)
+		if err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			response.Problem(w, r, http.StatusBadRequest, response.Error("failed to decode request"))
+			return
+		}
+
+		log.Info("request body decoded", slog.Any("request", req))
+
+		if err := validator.New().Struct(req); err != nil {
+			var validateErr validator.ValidationErrors
+			errors.As(err, &validateErr)
+
+			log.Error("invalid request", sl.Err(err))
+			response.Problem(w, r, http.StatusUnprocessableEntity, response.ValidationError(validateErr))
+			return
+		}
+
+		principal, _ := auth.PrincipalFromContext(r.Context())
+
+		domain := storage.Domain{
+			Host:      storage.Host(req.Host),
+			Workspace: principal.Workspace,
+			CreatedAt: time.Now().UTC(),
+		}
+		err = domainSaver.SaveDomain(r.Context(), domain)
+		if errors.Is(err, storage.ErrDomainExists) {
+			log.Info("domain already exists", slog.String("host", domain.Host))
+			response.Problem(w, r, http.StatusConflict, response.Error("domain already exists"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to add domain", sl.Err(err))
+			response.Problem(w, r, http.StatusInternalServerError, response.Error("failed to add domain"))
+			return
+		}
+
+		// the host may have served another workspace as the default domain
+		err = hostDeleterCache.DeleteHost(r.Context(), domain.Host)
+		if err != nil {
+			log.Error("failed to delete host from cache", sl.Err(err))
+		}
+
+		log.Info("domain added", slog.String("host", domain.Host))
+		render.JSON(w, r, Response{
+			Response: response.OK(),
+			Domain:   &domain,
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/raisultan/url-shortener/lib/api/response"
+	"github.com/raisultan/url-shortener/lib/http-server/middleware/auth"
+	"github.com/raisultan/url-shortener/lib/logger/sl"
+	"github.com/raisultan/url-shortener/services/main/internal/http-server/handlers/url/save"
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+	"golang.org/x/exp/slog"
+)
+
+const maxBatchSize = 1000
+
+type Result struct {
+	response.Response
+	Alias     string     `json:"alias,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Response holds a result for every requested url, in request order.
+type Response struct {
+	response.Response
+	Results []Result `json:"results,omitempty"`
+}
+
+type UrlsSaverStorage interface {
+	SaveUrls(ctx context.Context, links []storage.Link) ([]error, error)
+}
+
+type UrlsSaverCache interface {
+	SaveUrls(ctx context.Context, links []storage.Link) error
+}
+
+type AliasesGenerator interface {
+	GenerateAliases(ctx context.Context, count int) ([]string, error)
+}
+
+func New(
+	log *slog.Logger,
+	urlsSaverStorage UrlsSaverStorage,
+	urlsSaverCache UrlsSaverCache,
+	linkQuota save.LinkQuota,
+	aliasesGenerator AliasesGenerator,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.batch.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req []save.Request
+		err := render.DecodeJSON(r.Body, &req)
+		if err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			response.Problem(w, r, http.StatusBadRequest, response.Error("failed to decode request"))
+			return
+		}
+
+		if len(req) == 0 || len(req) > maxBatchSize {
+			log.Info("invalid batch size", slog.Int("size", len(req)))
+			msg := fmt.Sprintf("batch must contain 1 to %d urls", maxBatchSize)
+			response.Problem(w, r, http.StatusBadRequest, response.Error(msg))
+			return
+		}
+
+		log.Info("request body decoded", slog.Int("size", len(req)))
+
+		results := make([]Result, len(req))
+		links := make([]storage.Link, 0, len(req))
+		// positions of links in results, links only hold valid items
+		positions := make([]int, 0, len(req))
+		var withoutAlias []int
+
+		principal, _ := auth.PrincipalFromContext(r.Context())
+
+		validate := validator.New()
+		for i, item := range req {
+			if err := validate.Struct(item); err != nil {
+				var validateErr validator.ValidationErrors
+				errors.As(err, &validateErr)
+
+				results[i] = Result{Response: response.ValidationError(validateErr)}
+				continue
+			}
+
+			if storage.IsReservedAlias(item.Alias) {
+				results[i] = Result{Response: response.Error("alias is reserved"), Alias: item.Alias}
+				continue
+			}
+
+			expiresAt := item.ExpirationTime()
+			if storage.IsExpired(expiresAt) {
+				results[i] = Result{Response: response.Error("expires_at must be in the future")}
+				continue
+			}
+
+			link := storage.NewLink(principal.Workspace, item.Alias, item.Url)
+			link.ExpiresAt = expiresAt
+			link.Metadata = item.Metadata
+			link.Owner = principal.Name
+
+			if link.Alias == "" {
+				withoutAlias = append(withoutAlias, len(links))
+			}
+			links = append(links, link)
+			positions = append(positions, i)
+		}
+
+		if len(links) > 0 {
+			err = linkQuota.ReserveLinks(r.Context(), principal.Workspace, len(links))
+			if errors.Is(err, storage.ErrQuotaExceeded) {
+				log.Info("link quota exceeded", slog.String("workspace", principal.Workspace))
+				response.Problem(w, r, http.StatusForbidden, response.Error("link quota exceeded"))
+				return
+			}
+			if err != nil {
+				log.Error("failed to reserve links", sl.Err(err))
+				response.Problem(w, r, http.StatusInternalServerError, response.Error("failed to add urls"))
+				return
+			}
+		}
+
+		if len(withoutAlias) > 0 {
+			aliases, err := aliasesGenerator.GenerateAliases(r.Context(), len(withoutAlias))
+			if err != nil {
+				save.Release(r.Context(), log, linkQuota, principal.Workspace, len(links))
+				log.Error("failed to get aliases", sl.Err(err))
+				response.Problem(w, r, http.StatusServiceUnavailable, response.Error("failed to get aliases"))
+				return
+			}
+
+			for i, j := range withoutAlias {
+				links[j].Alias = aliases[i]
+			}
+		}
+
+		var saved []storage.Link
+		if len(links) > 0 {
+			errs, err := urlsSaverStorage.SaveUrls(r.Context(), links)
+			if err != nil {
+				save.Release(r.Context(), log, linkQuota, principal.Workspace, len(links))
+				log.Error("failed to add urls", sl.Err(err))
+				response.Problem(w, r, http.StatusInternalServerError, response.Error("failed to add urls"))
+				return
+			}
+
+			for i, link := range links {
+				results[positions[i]] = linkResult(log, link, errs[i])
+				if errs[i] == nil {
+					saved = append(saved, link)
+				}
+			}
+
+			if failed := len(links) - len(saved); failed > 0 {
+				save.Release(r.Context(), log, linkQuota, principal.Workspace, failed)
+			}
+		}
+
+		if len(saved) > 0 {
+			err = urlsSaverCache.SaveUrls(r.Context(), saved)
+			if err != nil {
+				log.Error("failed to add urls to cache", sl.Err(err))
+			}
+		}
+
+		log.Info("urls added", slog.Int("saved", len(saved)), slog.Int("requested", len(req)))
+		render.JSON(w, r, Response{
+			Response: response.OK(),
+			Results:  results,
+		})
+	}
+}
+
+func linkResult(log *slog.Logger, link storage.Link, err error) Result {
+	if errors.Is(err, storage.ErrUrlExists) {
+		return Result{Response: response.Error("url already exists"), Alias: link.Alias}
+	}
+	if err != nil {
+		log.Error("failed to add url", slog.String("alias", link.Alias), sl.Err(err))
+		return Result{Response: response.Error("failed to add url"), Alias: link.Alias}
+	}
+
+	res := Result{Response: response.OK(), Alias: link.Alias}
+	if !link.ExpiresAt.IsZero() {
+		expiresAt := link.ExpiresAt
+		res.ExpiresAt = &expiresAt
+	}
+
+	return res
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"github.com/raisultan/url-shortener/lib/api/response"
+	"github.com/raisultan/url-shortener/lib/http-server/middleware/auth"
 	"github.com/raisultan/url-shortener/lib/logger/sl"
 	"github.com/raisultan/url-shortener/services/main/internal/storage"
 	"golang.org/x/exp/slog"
@@ -14,11 +15,11 @@ import (
 )
 
 type UrlDeleterStorage interface {
-	DeleteUrl(ctx context.Context, alias string) error
+	DeleteUrl(ctx context.Context, workspace string, alias string, owner string) error
 }
 
 type UrlDeleterCache interface {
-	DeleteUrl(ctx context.Context, alias string) error
+	DeleteUrl(ctx context.Context, workspace string, alias string) error
 }
 
 func New(
@@ -34,20 +35,27 @@ func New(
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 		)
 
+		principal, _ := auth.PrincipalFromContext(r.Context())
+
 		alias := chi.URLParam(r, "alias")
-		err := urlDeleterStorage.DeleteUrl(r.Context(), alias)
+		err := urlDeleterStorage.DeleteUrl(r.Context(), principal.Workspace, alias, principal.Owner())
 		if errors.Is(err, storage.ErrUrlNotFound) {
 			log.Info("alias not found", slog.String("alias", alias))
-			render.JSON(w, r, response.Error("alias not found"))
+			response.Problem(w, r, http.StatusNotFound, response.Error("alias not found"))
+			return
+		}
+		if errors.Is(err, storage.ErrUrlNotOwned) {
+			log.Info("alias owned by another client", slog.String("alias", alias))
+			response.Problem(w, r, http.StatusForbidden, response.Error("alias belongs to another api key"))
 			return
 		}
 		if err != nil {
 			log.Error("failed to delete url", sl.Err(err))
-			render.JSON(w, r, response.Error("failed to delete url"))
+			response.Problem(w, r, http.StatusInternalServerError, response.Error("failed to delete url"))
 			return
 		}
 
-		err = urlDeleterCache.DeleteUrl(r.Context(), alias)
+		err = urlDeleterCache.DeleteUrl(r.Context(), principal.Workspace, alias)
 		if err != nil {
 			log.Error("failed to delete url from cache", sl.Err(err))
 		}
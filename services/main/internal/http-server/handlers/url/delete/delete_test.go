@@ -0,0 +1,55 @@
+package delete
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/raisultan/url-shortener/lib/http-server/middleware/auth"
+	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"github.com/raisultan/url-shortener/services/main/internal/lib/logger/handlers/slogdiscard"
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+	"github.com/raisultan/url-shortener/services/main/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+type cache struct{}
+
+func (cache) DeleteUrl(context.Context, string, string) error {
+	return nil
+}
+
+func TestNew_Ownership(t *testing.T) {
+	ctx := context.Background()
+	s, err := memory.New(config.Storages{}, ctx)
+	require.NoError(t, err)
+
+	owned := storage.NewLink(storage.DefaultWorkspace, "owned", "https://example.com")
+	owned.Owner = "owner"
+	require.NoError(t, s.SaveUrl(ctx, owned))
+	// links created before API keys were required have no owner
+	require.NoError(t, s.SaveUrl(ctx, storage.NewLink(storage.DefaultWorkspace, "ownerless", "https://example.com")))
+
+	router := chi.NewRouter()
+	router.Delete("/{alias}", New(slogdiscard.NewDiscardLogger(), s, cache{}))
+
+	del := func(alias string, principal auth.Principal) int {
+		r := httptest.NewRequest(http.MethodDelete, "/"+alias, nil)
+		r = r.WithContext(auth.WithPrincipal(r.Context(), principal))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		return w.Code
+	}
+
+	client := auth.Principal{Name: "intruder", Workspace: storage.DefaultWorkspace}
+	admin := auth.Principal{Name: "ops", Workspace: storage.DefaultWorkspace, Admin: true}
+
+	require.Equal(t, http.StatusForbidden, del("owned", client))
+	require.Equal(t, http.StatusForbidden, del("ownerless", client))
+	require.Equal(t, http.StatusOK, del("ownerless", admin))
+	require.Equal(t, http.StatusOK, del("owned", auth.Principal{Name: "owner", Workspace: storage.DefaultWorkspace}))
+	require.Equal(t, http.StatusNotFound, del("owned", admin))
+}
@@ -0,0 +1,59 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/raisultan/url-shortener/lib/api/response"
+	"github.com/raisultan/url-shortener/lib/http-server/middleware/auth"
+	"github.com/raisultan/url-shortener/lib/logger/sl"
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+	"golang.org/x/exp/slog"
+)
+
+type Response struct {
+	response.Response
+	Alias   string                 `json:"alias,omitempty"`
+	History []storage.HistoryEntry `json:"history"`
+}
+
+type UrlHistoryGetter interface {
+	GetUrlHistory(ctx context.Context, workspace string, alias string) ([]storage.HistoryEntry, error)
+}
+
+func New(log *slog.Logger, urlHistoryGetter UrlHistoryGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.history.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		principal, _ := auth.PrincipalFromContext(r.Context())
+
+		alias := chi.URLParam(r, "alias")
+		history, err := urlHistoryGetter.GetUrlHistory(r.Context(), principal.Workspace, alias)
+		if errors.Is(err, storage.ErrUrlNotFound) {
+			log.Info("alias not found", slog.String("alias", alias))
+			response.Problem(w, r, http.StatusNotFound, response.Error("alias not found"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to get url history", sl.Err(err))
+			response.Problem(w, r, http.StatusInternalServerError, response.Error("failed to get url history"))
+			return
+		}
+
+		log.Info("url history found", slog.Int("entries", len(history)))
+		render.JSON(w, r, Response{
+			Response: response.OK(),
+			Alias:    alias,
+			History:  history,
+		})
+	}
+}
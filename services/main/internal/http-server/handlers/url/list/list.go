@@ -0,0 +1,134 @@
+package list
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/raisultan/url-shortener/lib/api/response"
+	"github.com/raisultan/url-shortener/lib/http-server/middleware/auth"
+	"github.com/raisultan/url-shortener/lib/logger/sl"
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+type Response struct {
+	response.Response
+	Urls       []storage.Link `json:"urls"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+type UrlLister interface {
+	ListUrls(ctx context.Context, filter storage.ListFilter) (storage.LinkPage, error)
+}
+
+func New(log *slog.Logger, urlLister UrlLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.list.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		filter, err := parseFilter(r.URL.Query())
+		if err != nil {
+			log.Info("invalid query", sl.Err(err))
+			response.Problem(w, r, http.StatusBadRequest, response.Error(err.Error()))
+			return
+		}
+
+		principal, _ := auth.PrincipalFromContext(r.Context())
+		filter.Workspace = principal.Workspace
+
+		page, err := urlLister.ListUrls(r.Context(), filter)
+		if err != nil {
+			log.Error("failed to list urls", sl.Err(err))
+			response.Problem(w, r, http.StatusInternalServerError, response.Error("failed to list urls"))
+			return
+		}
+
+		log.Info("urls listed", slog.Int("count", len(page.Links)))
+		render.JSON(w, r, Response{
+			Response:   response.OK(),
+			Urls:       page.Links,
+			NextCursor: encodeCursor(page.Next),
+		})
+	}
+}
+
+func parseFilter(query url.Values) (storage.ListFilter, error) {
+	filter := storage.ListFilter{
+		Owner:       query.Get("owner"),
+		Domain:      query.Get("domain"),
+		AliasPrefix: query.Get("alias_prefix"),
+		Limit:       defaultLimit,
+	}
+
+	var err error
+	if filter.CreatedFrom, err = parseTime(query, "created_from"); err != nil {
+		return storage.ListFilter{}, err
+	}
+	if filter.CreatedTo, err = parseTime(query, "created_to"); err != nil {
+		return storage.ListFilter{}, err
+	}
+
+	if filter.After, err = decodeCursor(query.Get("cursor")); err != nil {
+		return storage.ListFilter{}, errors.New("invalid cursor")
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return storage.ListFilter{}, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
+
+func parseTime(query url.Values, key string) (time.Time, error) {
+	raw := query.Get(key)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time", key)
+	}
+
+	return t, nil
+}
+
+// Cursors are opaque to clients, so the way pages are keyed can change
+// without breaking them.
+func encodeCursor(after string) string {
+	if after == "" {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString([]byte(after))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	after, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", err
+	}
+
+	return string(after), nil
+}
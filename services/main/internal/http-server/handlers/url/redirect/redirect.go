@@ -3,9 +3,9 @@ package redirect
 import (
 	"context"
 	"errors"
-	"github.com/go-chi/render"
 	"github.com/raisultan/url-shortener/lib/api/response"
 	"github.com/raisultan/url-shortener/lib/logger/sl"
+	"github.com/raisultan/url-shortener/services/main/internal/analytics"
 	"github.com/raisultan/url-shortener/services/main/internal/storage"
 	"net/http"
 	"time"
@@ -17,30 +17,34 @@ import (
 
 const (
 	urlNotFoundMessage   = "url not found"
+	urlExpiredMessage    = "url expired"
+	urlDisabledMessage   = "url disabled"
 	internalErrorMessage = "internal error"
 )
 
+var errUrlDisabled = errors.New("url disabled")
+
 type UrlGetterStorage interface {
-	GetUrl(ctx context.Context, alias string) (string, error)
+	GetUrl(ctx context.Context, workspace string, alias string) (storage.Link, error)
 }
 
 type UrlGetterCache interface {
-	GetUrl(ctx context.Context, alias string) (string, error)
+	GetUrl(ctx context.Context, host string, alias string) (storage.Link, error)
+}
+
+type DomainResolver interface {
+	Resolve(ctx context.Context, host string) (storage.Domain, error)
 }
 
 type AnalyticsTracker interface {
-	TrackClickEvent(
-		r *http.Request,
-		alias string,
-		latency time.Duration,
-		errMessage string,
-	) error
+	TrackClickEvent(ctx context.Context, event analytics.ClickEvent) error
 }
 
 func New(
 	log *slog.Logger,
 	urlGetterStorage UrlGetterStorage,
 	urlGetterCache UrlGetterCache,
+	domainResolver DomainResolver,
 	analyticsTracker AnalyticsTracker,
 ) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -53,21 +57,51 @@ func New(
 
 		startTime := time.Now()
 		alias := chi.URLParam(r, "alias")
-		resUrl, errMessage := getUrl(r.Context(), log, urlGetterCache, urlGetterStorage, alias)
+		domain, link, err := getUrl(r.Context(), log, urlGetterCache, urlGetterStorage, domainResolver, r.Host, alias)
+		errMessage := errorMessage(err)
 
 		latency := time.Since(startTime)
-		err := analyticsTracker.TrackClickEvent(r, alias, latency, errMessage)
-		if err != nil {
-			log.Error("failed to send click analytics event", sl.Err(err))
+		event := analytics.NewClickEvent(r, alias, latency, errMessage)
+		event.Workspace = domain.Workspace
+		trackErr := analyticsTracker.TrackClickEvent(r.Context(), event)
+		if trackErr != nil {
+			log.Error("failed to track click event", sl.Err(trackErr))
 		} else {
-			log.Info("click event sent to analytics storage")
+			log.Info("click event tracked")
 		}
 
-		if errMessage != "" {
-			render.JSON(w, r, response.Error(errMessage))
-		} else {
-			http.Redirect(w, r, resUrl, http.StatusFound)
+		if err == nil {
+			http.Redirect(w, r, link.Url, http.StatusFound)
+			return
 		}
+
+		response.Problem(w, r, statusCode(err), response.Error(errMessage))
+	}
+}
+
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrUrlNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrUrlExpired), errors.Is(err, errUrlDisabled):
+		return http.StatusGone
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func errorMessage(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, storage.ErrUrlNotFound):
+		return urlNotFoundMessage
+	case errors.Is(err, storage.ErrUrlExpired):
+		return urlExpiredMessage
+	case errors.Is(err, errUrlDisabled):
+		return urlDisabledMessage
+	default:
+		return internalErrorMessage
 	}
 }
 
@@ -76,27 +110,56 @@ func getUrl(
 	log *slog.Logger,
 	urlGetterCache UrlGetterCache,
 	urlGetterStorage UrlGetterStorage,
+	domainResolver DomainResolver,
+	host string,
 	alias string,
-) (string, string) {
-	resUrl, err := urlGetterCache.GetUrl(ctx, alias)
+) (storage.Domain, storage.Link, error) {
+	domain, err := domainResolver.Resolve(ctx, host)
+	if err != nil {
+		log.Error("failed to resolve domain", slog.String("host", host), sl.Err(err))
+		return storage.Domain{}, storage.Link{}, err
+	}
+
+	link, err := urlGetterCache.GetUrl(ctx, domain.Host, alias)
 	if err == nil {
-		log.Info("got url from cache", slog.String("url", resUrl))
-		return resUrl, ""
+		log.Info("got url from cache", slog.String("url", link.Url))
+		return domain, link, checkLink(log, link)
 	}
 
 	log.Info("url not found in cache, checking storage", "alias", alias)
-	resUrl, err = urlGetterStorage.GetUrl(ctx, alias)
+	link, err = urlGetterStorage.GetUrl(ctx, domain.Workspace, alias)
 
 	if errors.Is(err, storage.ErrUrlNotFound) {
 		log.Info("url not found in storage", "alias", alias)
-		return "", urlNotFoundMessage
+		return domain, storage.Link{}, err
+	}
+
+	if errors.Is(err, storage.ErrUrlExpired) {
+		log.Info("url expired", "alias", alias)
+		return domain, storage.Link{}, err
 	}
 
 	if err != nil {
 		log.Error("failed to get url from storage", sl.Err(err))
-		return "", internalErrorMessage
+		return domain, storage.Link{}, err
+	}
+
+	log.Info("got url from storage", slog.String("url", link.Url))
+	return domain, link, checkLink(log, link)
+}
+
+// checkLink rejects links that must not be followed, storages reject expired
+// links themselves, but cached ones are checked here as well.
+func checkLink(log *slog.Logger, link storage.Link) error {
+	if link.IsExpired() {
+		log.Info("url expired", "alias", link.Alias)
+		return storage.ErrUrlExpired
+	}
+
+	if link.Status == storage.LinkStatusDisabled {
+		log.Info("url disabled", "alias", link.Alias)
+		return errUrlDisabled
 	}
 
-	log.Info("got url from storage", slog.String("url", resUrl))
-	return resUrl, ""
+	return nil
 }
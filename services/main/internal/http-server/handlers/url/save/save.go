@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"github.com/raisultan/url-shortener/lib/api/response"
+	"github.com/raisultan/url-shortener/lib/http-server/middleware/auth"
 	"github.com/raisultan/url-shortener/lib/logger/sl"
 	"github.com/raisultan/url-shortener/services/main/internal/storage"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
@@ -14,40 +16,46 @@ import (
 	"golang.org/x/exp/slog"
 )
 
+// Request optionally limits the url lifetime either with an absolute
+// ExpiresAt or with TTL in seconds, but not with both. TTL is at most 100
+// years, so the expiration time doesn't overflow.
 type Request struct {
-	Url   string `json:"url" validate:"required,url"`
-	Alias string `json:"alias,omitempty"`
+	Url       string            `json:"url" validate:"required,url"`
+	Alias     string            `json:"alias,omitempty"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty" validate:"excluded_with=TTL"`
+	TTL       int64             `json:"ttl,omitempty" validate:"gte=0,lte=3153600000"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
 }
 
 type Response struct {
 	response.Response
-	Alias string `json:"alias,omitempty"`
+	Alias     string     `json:"alias,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 type UrlSaverStorage interface {
-	SaveUrl(
-		ctx context.Context,
-		urlToSave string,
-		alias string,
-	) error
+	SaveUrl(ctx context.Context, link storage.Link) error
 }
 
 type UrlSaverCache interface {
-	SaveUrl(
-		ctx context.Context,
-		urlToSave string,
-		alias string,
-	) error
+	SaveUrl(ctx context.Context, link storage.Link) error
+}
+
+// LinkQuota counts links created in workspaces against their quotas.
+type LinkQuota interface {
+	ReserveLinks(ctx context.Context, workspace string, n int) error
+	ReleaseLinks(ctx context.Context, workspace string, n int) error
 }
 
 type AliasGenerator interface {
-	GenerateAlias() (string, error)
+	GenerateAlias(ctx context.Context) (string, error)
 }
 
 func New(
 	log *slog.Logger,
 	urlSaverStorage UrlSaverStorage,
 	urlSaverCache UrlSaverCache,
+	linkQuota LinkQuota,
 	aliasGenerator AliasGenerator,
 ) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -62,7 +70,7 @@ func New(
 		err := render.DecodeJSON(r.Body, &req)
 		if err != nil {
 			log.Error("failed to decode request body", sl.Err(err))
-			render.JSON(w, r, response.Error("failed to decode request"))
+			response.Problem(w, r, http.StatusBadRequest, response.Error("failed to decode request"))
 			return
 		}
 
@@ -73,41 +81,113 @@ func New(
 			errors.As(err, &validateErr)
 
 			log.Error("invalid request", sl.Err(err))
-			render.JSON(w, r, response.ValidationError(validateErr))
+			response.Problem(w, r, validationStatus(validateErr), response.ValidationError(validateErr))
+			return
+		}
+
+		if storage.IsReservedAlias(req.Alias) {
+			log.Info("alias is reserved", slog.String("alias", req.Alias))
+			response.Problem(w, r, http.StatusUnprocessableEntity, response.Error("alias is reserved"))
+			return
+		}
+
+		expiresAt := req.ExpirationTime()
+		if storage.IsExpired(expiresAt) {
+			log.Info("expiration time is in the past", slog.Time("expires_at", expiresAt))
+			response.Problem(w, r, http.StatusUnprocessableEntity, response.Error("expires_at must be in the future"))
+			return
+		}
+
+		principal, _ := auth.PrincipalFromContext(r.Context())
+
+		err = linkQuota.ReserveLinks(r.Context(), principal.Workspace, 1)
+		if errors.Is(err, storage.ErrQuotaExceeded) {
+			log.Info("link quota exceeded", slog.String("workspace", principal.Workspace))
+			response.Problem(w, r, http.StatusForbidden, response.Error("link quota exceeded"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to reserve link", sl.Err(err))
+			response.Problem(w, r, http.StatusInternalServerError, response.Error("failed to add url"))
 			return
 		}
 
 		alias := req.Alias
 		if alias == "" {
-			alias, err = aliasGenerator.GenerateAlias()
+			alias, err = aliasGenerator.GenerateAlias(r.Context())
 			if err != nil {
+				Release(r.Context(), log, linkQuota, principal.Workspace, 1)
 				log.Error("failed to get alias", sl.Err(err))
-				render.JSON(w, r, response.Error("failed to get alias"))
+				response.Problem(w, r, http.StatusServiceUnavailable, response.Error("failed to get alias"))
 				return
 			}
 		}
 
-		err = urlSaverStorage.SaveUrl(r.Context(), req.Url, alias)
+		link := storage.NewLink(principal.Workspace, alias, req.Url)
+		link.ExpiresAt = expiresAt
+		link.Metadata = req.Metadata
+		link.Owner = principal.Name
+
+		err = urlSaverStorage.SaveUrl(r.Context(), link)
+		if err != nil {
+			Release(r.Context(), log, linkQuota, principal.Workspace, 1)
+		}
 		if errors.Is(err, storage.ErrUrlExists) {
 			log.Info("url already exists", slog.String("url", req.Url))
-			render.JSON(w, r, response.Error("url already exists"))
+			response.Problem(w, r, http.StatusConflict, response.Error("url already exists"))
 			return
 		}
 		if err != nil {
 			log.Error("failed to add url", sl.Err(err))
-			render.JSON(w, r, response.Error("failed to add url"))
+			response.Problem(w, r, http.StatusInternalServerError, response.Error("failed to add url"))
 			return
 		}
 
-		err = urlSaverCache.SaveUrl(r.Context(), req.Url, alias)
+		err = urlSaverCache.SaveUrl(r.Context(), link)
 		if err != nil {
 			log.Error("failed to add url to cache", sl.Err(err))
 		}
 
 		log.Info("url added")
-		render.JSON(w, r, Response{
+		resp := Response{
 			Response: response.OK(),
 			Alias:    alias,
-		})
+		}
+		if !expiresAt.IsZero() {
+			resp.ExpiresAt = &expiresAt
+		}
+		render.JSON(w, r, resp)
+	}
+}
+
+// Release gives back links reserved for a request that failed to create them,
+// a failure only leaves the quota lower than it should be.
+func Release(ctx context.Context, log *slog.Logger, linkQuota LinkQuota, workspace string, n int) {
+	if err := linkQuota.ReleaseLinks(ctx, workspace, n); err != nil {
+		log.Error("failed to release links", slog.Int("count", n), sl.Err(err))
+	}
+}
+
+// ExpirationTime returns zero time for urls that never expire.
+func (req Request) ExpirationTime() time.Time {
+	if req.ExpiresAt != nil {
+		return req.ExpiresAt.UTC()
+	}
+	if req.TTL > 0 {
+		return time.Now().UTC().Add(time.Duration(req.TTL) * time.Second)
+	}
+
+	return time.Time{}
+}
+
+// validationStatus answers 400 Bad Request for values out of the bounds of a
+// field, 422 Unprocessable Entity for other invalid requests.
+func validationStatus(errs validator.ValidationErrors) int {
+	for _, err := range errs {
+		if err.ActualTag() == "lte" {
+			return http.StatusBadRequest
+		}
 	}
+
+	return http.StatusUnprocessableEntity
 }
@@ -0,0 +1,51 @@
+package save
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/raisultan/url-shortener/lib/api/response"
+	"github.com/raisultan/url-shortener/services/main/internal/lib/logger/handlers/slogdiscard"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_TTL(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		code  int
+		error string
+	}{
+		{
+			name:  "negative",
+			body:  `{"url": "https://example.com", "ttl": -1}`,
+			code:  http.StatusUnprocessableEntity,
+			error: "field TTL is not valid",
+		},
+		{
+			name:  "overflows expiration time",
+			body:  `{"url": "https://example.com", "ttl": 9223372036854775807}`,
+			code:  http.StatusBadRequest,
+			error: "field TTL must be at most 3153600000",
+		},
+	}
+
+	// invalid requests are rejected before any dependency is used
+	handler := New(slogdiscard.NewDiscardLogger(), nil, nil, nil, nil)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/url", strings.NewReader(tt.body)))
+
+			require.Equal(t, tt.code, w.Code)
+
+			var resp response.Response
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			require.Equal(t, tt.error, resp.Error)
+		})
+	}
+}
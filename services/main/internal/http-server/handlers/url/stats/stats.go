@@ -0,0 +1,149 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/raisultan/url-shortener/lib/api/response"
+	"github.com/raisultan/url-shortener/lib/http-server/middleware/auth"
+	"github.com/raisultan/url-shortener/lib/logger/sl"
+	"github.com/raisultan/url-shortener/services/main/internal/analytics"
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	defaultTop = 10
+	maxTop     = 100
+)
+
+type Response struct {
+	response.Response
+	Alias string          `json:"alias,omitempty"`
+	Stats analytics.Stats `json:"stats"`
+}
+
+type UrlGetter interface {
+	GetUrl(ctx context.Context, workspace string, alias string) (storage.Link, error)
+}
+
+type StatsGetter interface {
+	GetClickStats(ctx context.Context, filter analytics.StatsFilter) (analytics.Stats, error)
+}
+
+func New(log *slog.Logger, urlGetter UrlGetter, statsGetter StatsGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.stats.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		filter, err := parseFilter(r.URL.Query())
+		if err != nil {
+			log.Info("invalid query", sl.Err(err))
+			response.Problem(w, r, http.StatusBadRequest, response.Error(err.Error()))
+			return
+		}
+
+		principal, _ := auth.PrincipalFromContext(r.Context())
+		filter.Workspace = principal.Workspace
+		filter.Alias = chi.URLParam(r, "alias")
+
+		// expired links keep their stats
+		_, err = urlGetter.GetUrl(r.Context(), filter.Workspace, filter.Alias)
+		if errors.Is(err, storage.ErrUrlNotFound) {
+			log.Info("alias not found", slog.String("alias", filter.Alias))
+			response.Problem(w, r, http.StatusNotFound, response.Error("alias not found"))
+			return
+		}
+		if err != nil && !errors.Is(err, storage.ErrUrlExpired) {
+			log.Error("failed to get url", sl.Err(err))
+			response.Problem(w, r, http.StatusInternalServerError, response.Error("failed to get url stats"))
+			return
+		}
+
+		stats, err := statsGetter.GetClickStats(r.Context(), filter)
+		if err != nil {
+			log.Error("failed to get url stats", sl.Err(err))
+			response.Problem(w, r, http.StatusInternalServerError, response.Error("failed to get url stats"))
+			return
+		}
+
+		log.Info("url stats found", slog.Uint64("clicks", stats.TotalClicks))
+		render.JSON(w, r, Response{
+			Response: response.OK(),
+			Alias:    filter.Alias,
+			Stats:    stats,
+		})
+	}
+}
+
+func parseFilter(query url.Values) (analytics.StatsFilter, error) {
+	filter := analytics.StatsFilter{
+		Granularity: analytics.GranularityDay,
+		Top:         defaultTop,
+	}
+
+	var err error
+	if filter.From, err = parseTime(query, "from"); err != nil {
+		return analytics.StatsFilter{}, err
+	}
+	if filter.To, err = parseTime(query, "to"); err != nil {
+		return analytics.StatsFilter{}, err
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return analytics.StatsFilter{}, errors.New("from must be before to")
+	}
+
+	switch granularity := query.Get("granularity"); granularity {
+	case "":
+	case analytics.GranularityHour, analytics.GranularityDay:
+		filter.Granularity = granularity
+	default:
+		return analytics.StatsFilter{}, fmt.Errorf(
+			"granularity must be %s or %s", analytics.GranularityHour, analytics.GranularityDay,
+		)
+	}
+
+	if raw := query.Get("include_bots"); raw != "" {
+		includeBots, err := strconv.ParseBool(raw)
+		if err != nil {
+			return analytics.StatsFilter{}, errors.New("include_bots must be a boolean")
+		}
+		filter.IncludeBots = includeBots
+	}
+
+	if raw := query.Get("top"); raw != "" {
+		top, err := strconv.Atoi(raw)
+		if err != nil || top < 1 || top > maxTop {
+			return analytics.StatsFilter{}, fmt.Errorf("top must be between 1 and %d", maxTop)
+		}
+		filter.Top = top
+	}
+
+	return filter, nil
+}
+
+func parseTime(query url.Values, key string) (time.Time, error) {
+	raw := query.Get(key)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time", key)
+	}
+
+	return t, nil
+}
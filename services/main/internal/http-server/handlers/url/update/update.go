@@ -0,0 +1,113 @@
+package update
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/raisultan/url-shortener/lib/api/response"
+	"github.com/raisultan/url-shortener/lib/http-server/middleware/auth"
+	"github.com/raisultan/url-shortener/lib/logger/sl"
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+	"golang.org/x/exp/slog"
+)
+
+type Request struct {
+	Url string `json:"url" validate:"required,url"`
+}
+
+type Response struct {
+	response.Response
+	Alias string `json:"alias,omitempty"`
+	Url   string `json:"url,omitempty"`
+}
+
+type UrlUpdaterStorage interface {
+	UpdateUrl(
+		ctx context.Context,
+		workspace string,
+		alias string,
+		url string,
+		owner string,
+	) (storage.Link, error)
+}
+
+type UrlDeleterCache interface {
+	DeleteUrl(ctx context.Context, workspace string, alias string) error
+}
+
+func New(
+	log *slog.Logger,
+	urlUpdaterStorage UrlUpdaterStorage,
+	urlDeleterCache UrlDeleterCache,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.update.New"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req Request
+		err := render.DecodeJSON(r.Body, &req)
+		if err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			response.Problem(w, r, http.StatusBadRequest, response.Error("failed to decode request"))
+			return
+		}
+
+		log.Info("request body decoded", slog.Any("request", req))
+
+		if err := validator.New().Struct(req); err != nil {
+			var validateErr validator.ValidationErrors
+			errors.As(err, &validateErr)
+
+			log.Error("invalid request", sl.Err(err))
+			response.Problem(w, r, http.StatusUnprocessableEntity, response.ValidationError(validateErr))
+			return
+		}
+
+		principal, _ := auth.PrincipalFromContext(r.Context())
+
+		alias := chi.URLParam(r, "alias")
+		link, err := urlUpdaterStorage.UpdateUrl(r.Context(), principal.Workspace, alias, req.Url, principal.Owner())
+		if errors.Is(err, storage.ErrUrlNotFound) {
+			log.Info("alias not found", slog.String("alias", alias))
+			response.Problem(w, r, http.StatusNotFound, response.Error("alias not found"))
+			return
+		}
+		if errors.Is(err, storage.ErrUrlNotOwned) {
+			log.Info("alias owned by another client", slog.String("alias", alias))
+			response.Problem(w, r, http.StatusForbidden, response.Error("alias belongs to another api key"))
+			return
+		}
+		if errors.Is(err, storage.ErrUrlExpired) {
+			log.Info("alias expired", slog.String("alias", alias))
+			response.Problem(w, r, http.StatusGone, response.Error("alias expired"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to update url", sl.Err(err))
+			response.Problem(w, r, http.StatusInternalServerError, response.Error("failed to update url"))
+			return
+		}
+
+		// the cache holds the previous destination until invalidated
+		err = urlDeleterCache.DeleteUrl(r.Context(), principal.Workspace, alias)
+		if err != nil {
+			log.Error("failed to delete url from cache", sl.Err(err))
+		}
+
+		log.Info("url updated", slog.String("alias", alias))
+		render.JSON(w, r, Response{
+			Response: response.OK(),
+			Alias:    link.Alias,
+			Url:      link.Url,
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const Namespace = "url_shortener"
+
+var (
+	// CacheRequests counts link lookups in the cache by result: hit, miss or error.
+	CacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "cache",
+		Name:      "requests_total",
+		Help:      "Number of link lookups in the cache by result.",
+	}, []string{"result"})
+
+	StorageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "storage",
+		Name:      "operation_duration_seconds",
+		Help:      "Latency of storage operations.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	// AnalyticsInsertFailures counts click events a sink failed to insert,
+	// spooled events are counted when they are spooled, not on every replay.
+	AnalyticsInsertFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "analytics",
+		Name:      "insert_failures_total",
+		Help:      "Number of click events that failed to be inserted by sink.",
+	}, []string{"sink"})
+
+	// AnalyticsDroppedEvents counts click events dropped because the queue or
+	// the spool of the sink was full or the service was stopping.
+	AnalyticsDroppedEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "analytics",
+		Name:      "dropped_events_total",
+		Help:      "Number of click events dropped before they were inserted by sink.",
+	}, []string{"sink"})
+
+	// AnalyticsQuarantinedSegments counts spool segments set aside after the
+	// sink rejected them too many times.
+	AnalyticsQuarantinedSegments = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "analytics",
+		Name:      "quarantined_segments_total",
+		Help:      "Number of spool segments quarantined after failed replays by sink.",
+	}, []string{"sink"})
+
+	AnalyticsSpoolBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Subsystem: "analytics",
+		Name:      "spool_bytes",
+		Help:      "Size of click events waiting in the spool to be replayed by sink.",
+	}, []string{"sink"})
+
+	// AnalyticsQuarantinedBytes counts toward the spool size limit until the
+	// quarantined segments are removed.
+	AnalyticsQuarantinedBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Subsystem: "analytics",
+		Name:      "spool_quarantined_bytes",
+		Help:      "Size of quarantined spool segments by sink.",
+	}, []string{"sink"})
+)
@@ -0,0 +1,610 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/raisultan/url-shortener/lib/logger/sl"
+	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+	"golang.org/x/exp/slog"
+)
+
+// Storage keeps urls in process memory. If snapshot path is configured, urls are
+// loaded from it on start and written back to it on Close.
+type Storage struct {
+	mu           sync.RWMutex
+	urls         map[linkKey]storage.Link
+	history      map[linkKey][]storage.HistoryEntry
+	apiKeys      map[string]storage.APIKey
+	workspaces   map[string]storage.Workspace
+	domains      map[string]storage.Domain
+	snapshotPath string
+}
+
+// linkKey identifies a link, aliases are unique within a workspace.
+type linkKey struct {
+	workspace string
+	alias     string
+}
+
+type snapshot struct {
+	Links      []storage.Link            `json:"links"`
+	History    []storage.HistoryEntry    `json:"history_entries"`
+	APIKeys    map[string]storage.APIKey `json:"api_keys"`
+	Workspaces []storage.Workspace       `json:"workspaces"`
+	Domains    []storage.Domain          `json:"domains"`
+}
+
+func New(config config.Storages, _ context.Context) (*Storage, error) {
+	const op = "storage.memory.New"
+
+	s := &Storage{
+		urls:         make(map[linkKey]storage.Link),
+		history:      make(map[linkKey][]storage.HistoryEntry),
+		apiKeys:      make(map[string]storage.APIKey),
+		workspaces:   make(map[string]storage.Workspace),
+		domains:      make(map[string]storage.Domain),
+		snapshotPath: config.Memory.SnapshotPath,
+	}
+
+	if s.snapshotPath != "" {
+		if err := s.restore(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if _, ok := s.workspaces[storage.DefaultWorkspace]; !ok {
+		s.workspaces[storage.DefaultWorkspace] = storage.Workspace{
+			ID:        storage.DefaultWorkspace,
+			CreatedAt: time.Now().UTC(),
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Storage) restore() error {
+	data, err := os.ReadFile(s.snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+
+	for _, link := range snap.Links {
+		s.urls[linkKey{link.Workspace, link.Alias}] = link
+	}
+	for _, entry := range snap.History {
+		key := linkKey{entry.Workspace, entry.Alias}
+		s.history[key] = append(s.history[key], entry)
+	}
+	for _, entries := range s.history {
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].ChangedAt.Before(entries[j].ChangedAt) })
+	}
+	if snap.APIKeys != nil {
+		s.apiKeys = snap.APIKeys
+	}
+	for _, ws := range snap.Workspaces {
+		s.workspaces[ws.ID] = ws
+	}
+	for _, domain := range snap.Domains {
+		s.domains[domain.Host] = domain
+	}
+
+	return nil
+}
+
+// Ping always succeeds, the storage lives in the process.
+func (s *Storage) Ping(_ context.Context) error {
+	return nil
+}
+
+func (s *Storage) Close(_ context.Context, log *slog.Logger) {
+	if s.snapshotPath == "" {
+		return
+	}
+
+	err := s.snapshot()
+	if err != nil {
+		log.Error("could not save storage snapshot", sl.Err(err))
+	}
+}
+
+func (s *Storage) SaveUrl(ctx context.Context, link storage.Link) error {
+	const op = "storage.memory.SaveUrl"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := linkKey{link.Workspace, link.Alias}
+	if _, ok := s.urls[key]; ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrUrlExists)
+	}
+	s.urls[key] = cloneLink(link)
+
+	return nil
+}
+
+// SaveUrls saves links atomically. Links that can't be saved get an error
+// at their index in the returned slice, the others get nil.
+func (s *Storage) SaveUrls(ctx context.Context, links []storage.Link) ([]error, error) {
+	const op = "storage.memory.SaveUrls"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs := make([]error, len(links))
+	for i, link := range links {
+		key := linkKey{link.Workspace, link.Alias}
+		if _, ok := s.urls[key]; ok {
+			errs[i] = fmt.Errorf("%s: %w", op, storage.ErrUrlExists)
+			continue
+		}
+		s.urls[key] = cloneLink(link)
+	}
+
+	return errs, nil
+}
+
+func (s *Storage) GetUrl(ctx context.Context, workspace string, alias string) (storage.Link, error) {
+	const op = "storage.memory.GetUrl"
+
+	if err := ctx.Err(); err != nil {
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	link, ok := s.urls[linkKey{workspace, alias}]
+	if !ok {
+		return storage.Link{}, storage.ErrUrlNotFound
+	}
+
+	if link.IsExpired() {
+		return storage.Link{}, storage.ErrUrlExpired
+	}
+
+	return cloneLink(link), nil
+}
+
+// DeleteUrl deletes the link if it belongs to the owner, empty owner deletes
+// any link.
+func (s *Storage) DeleteUrl(ctx context.Context, workspace string, alias string, owner string) error {
+	const op = "storage.memory.DeleteUrl"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := linkKey{workspace, alias}
+	link, ok := s.urls[key]
+	if !ok {
+		return storage.ErrUrlNotFound
+	}
+
+	if !link.OwnedBy(owner) {
+		return storage.ErrUrlNotOwned
+	}
+
+	delete(s.urls, key)
+	delete(s.history, key)
+
+	return nil
+}
+
+// UpdateUrl changes the destination of the link and records the previous
+// one in the history. Like DeleteUrl, it is restricted to the link owner.
+func (s *Storage) UpdateUrl(
+	ctx context.Context,
+	workspace string,
+	alias string,
+	url string,
+	owner string,
+) (storage.Link, error) {
+	const op = "storage.memory.UpdateUrl"
+
+	if err := ctx.Err(); err != nil {
+		return storage.Link{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := linkKey{workspace, alias}
+	link, ok := s.urls[key]
+	if !ok {
+		return storage.Link{}, storage.ErrUrlNotFound
+	}
+
+	if !link.OwnedBy(owner) {
+		return storage.Link{}, storage.ErrUrlNotOwned
+	}
+
+	if link.IsExpired() {
+		return storage.Link{}, storage.ErrUrlExpired
+	}
+
+	now := time.Now().UTC()
+	s.history[key] = append(s.history[key], storage.HistoryEntry{
+		Workspace: workspace,
+		Alias:     alias,
+		Url:       link.Url,
+		ChangedAt: now,
+	})
+
+	link.Url = url
+	link.UpdatedAt = now
+	s.urls[key] = link
+
+	return cloneLink(link), nil
+}
+
+// GetUrlHistory returns previous destinations of the link, latest first.
+func (s *Storage) GetUrlHistory(ctx context.Context, workspace string, alias string) ([]storage.HistoryEntry, error) {
+	const op = "storage.memory.GetUrlHistory"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := linkKey{workspace, alias}
+	if _, ok := s.urls[key]; !ok {
+		return nil, storage.ErrUrlNotFound
+	}
+
+	entries := s.history[key]
+	history := make([]storage.HistoryEntry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		history = append(history, entries[i])
+	}
+
+	return history, nil
+}
+
+// ListUrls returns a page of links matching the filter, ordered by alias.
+func (s *Storage) ListUrls(ctx context.Context, filter storage.ListFilter) (storage.LinkPage, error) {
+	const op = "storage.memory.ListUrls"
+
+	if err := ctx.Err(); err != nil {
+		return storage.LinkPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	links := []storage.Link{}
+	for _, link := range s.urls {
+		if matches(link, filter) {
+			links = append(links, cloneLink(link))
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(links, func(i, j int) bool { return links[i].Alias < links[j].Alias })
+	if len(links) > filter.Limit+1 {
+		links = links[:filter.Limit+1]
+	}
+
+	return storage.NewLinkPage(links, filter.Limit), nil
+}
+
+func (s *Storage) SaveAPIKey(ctx context.Context, key storage.APIKey) error {
+	const op = "storage.memory.SaveAPIKey"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.workspaces[key.Workspace]; !ok {
+		return storage.ErrWorkspaceNotFound
+	}
+
+	for _, k := range s.apiKeys {
+		if k.Name == key.Name {
+			return fmt.Errorf("%s: %w", op, storage.ErrAPIKeyExists)
+		}
+	}
+	if _, ok := s.apiKeys[key.Hash]; ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrAPIKeyExists)
+	}
+	s.apiKeys[key.Hash] = key
+
+	return nil
+}
+
+func (s *Storage) GetAPIKey(ctx context.Context, hash string) (storage.APIKey, error) {
+	const op = "storage.memory.GetAPIKey"
+
+	if err := ctx.Err(); err != nil {
+		return storage.APIKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.apiKeys[hash]
+	if !ok {
+		return storage.APIKey{}, storage.ErrAPIKeyNotFound
+	}
+	if key.Workspace == "" {
+		key.Workspace = storage.DefaultWorkspace
+	}
+
+	return key, nil
+}
+
+func (s *Storage) SaveWorkspace(ctx context.Context, ws storage.Workspace) error {
+	const op = "storage.memory.SaveWorkspace"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.workspaces[ws.ID]; ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrWorkspaceExists)
+	}
+	s.workspaces[ws.ID] = ws
+
+	return nil
+}
+
+func (s *Storage) GetWorkspace(ctx context.Context, id string) (storage.Workspace, error) {
+	const op = "storage.memory.GetWorkspace"
+
+	if err := ctx.Err(); err != nil {
+		return storage.Workspace{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ws, ok := s.workspaces[id]
+	if !ok {
+		return storage.Workspace{}, storage.ErrWorkspaceNotFound
+	}
+
+	return ws, nil
+}
+
+// ReserveLinks counts n links as created in the workspace, unless that
+// exceeds its quota.
+func (s *Storage) ReserveLinks(ctx context.Context, workspace string, n int) error {
+	const op = "storage.memory.ReserveLinks"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ws, ok := s.workspaces[workspace]
+	if !ok {
+		return storage.ErrWorkspaceNotFound
+	}
+
+	if ws.LinkQuota > 0 && ws.LinksCreated+n > ws.LinkQuota {
+		return storage.ErrQuotaExceeded
+	}
+
+	ws.LinksCreated += n
+	s.workspaces[workspace] = ws
+
+	return nil
+}
+
+// ReleaseLinks gives back n reserved links that were not created after all.
+func (s *Storage) ReleaseLinks(ctx context.Context, workspace string, n int) error {
+	const op = "storage.memory.ReleaseLinks"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ws, ok := s.workspaces[workspace]
+	if !ok {
+		return storage.ErrWorkspaceNotFound
+	}
+
+	ws.LinksCreated = max(ws.LinksCreated-n, 0)
+	s.workspaces[workspace] = ws
+
+	return nil
+}
+
+func (s *Storage) SaveDomain(ctx context.Context, domain storage.Domain) error {
+	const op = "storage.memory.SaveDomain"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.workspaces[domain.Workspace]; !ok {
+		return storage.ErrWorkspaceNotFound
+	}
+
+	if _, ok := s.domains[domain.Host]; ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrDomainExists)
+	}
+	s.domains[domain.Host] = domain
+
+	return nil
+}
+
+func (s *Storage) GetDomain(ctx context.Context, host string) (storage.Domain, error) {
+	const op = "storage.memory.GetDomain"
+
+	if err := ctx.Err(); err != nil {
+		return storage.Domain{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	domain, ok := s.domains[host]
+	if !ok {
+		return storage.Domain{}, storage.ErrDomainNotFound
+	}
+
+	return domain, nil
+}
+
+func (s *Storage) ListDomains(ctx context.Context, workspace string) ([]storage.Domain, error) {
+	const op = "storage.memory.ListDomains"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	domains := []storage.Domain{}
+	for _, domain := range s.domains {
+		if domain.Workspace == workspace {
+			domains = append(domains, domain)
+		}
+	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i].Host < domains[j].Host })
+
+	return domains, nil
+}
+
+func (s *Storage) DeleteDomain(ctx context.Context, workspace string, host string) error {
+	const op = "storage.memory.DeleteDomain"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	domain, ok := s.domains[host]
+	if !ok || domain.Workspace != workspace {
+		return storage.ErrDomainNotFound
+	}
+	delete(s.domains, host)
+
+	return nil
+}
+
+func matches(link storage.Link, filter storage.ListFilter) bool {
+	switch {
+	case link.Workspace != filter.Workspace:
+		return false
+	case filter.Owner != "" && link.Owner != filter.Owner:
+		return false
+	case !filter.CreatedFrom.IsZero() && link.CreatedAt.Before(filter.CreatedFrom):
+		return false
+	case !filter.CreatedTo.IsZero() && !link.CreatedAt.Before(filter.CreatedTo):
+		return false
+	case filter.Domain != "" && storage.UrlHost(link.Url) != strings.ToLower(filter.Domain):
+		return false
+	case !strings.HasPrefix(link.Alias, filter.AliasPrefix):
+		return false
+	case filter.After != "" && link.Alias <= filter.After:
+		return false
+	default:
+		return true
+	}
+}
+
+// cloneLink copies metadata, so callers can't modify stored links.
+func cloneLink(link storage.Link) storage.Link {
+	if link.Metadata != nil {
+		metadata := make(map[string]string, len(link.Metadata))
+		for k, v := range link.Metadata {
+			metadata[k] = v
+		}
+		link.Metadata = metadata
+	}
+
+	return link
+}
+
+// snapshot writes urls into a temporary file next to the snapshot path and
+// renames it, so a crash in the middle never leaves a truncated snapshot.
+func (s *Storage) snapshot() error {
+	const op = "storage.memory.snapshot"
+
+	s.mu.RLock()
+	snap := snapshot{APIKeys: s.apiKeys}
+	for _, link := range s.urls {
+		snap.Links = append(snap.Links, link)
+	}
+	for _, entries := range s.history {
+		snap.History = append(snap.History, entries...)
+	}
+	for _, ws := range s.workspaces {
+		snap.Workspaces = append(snap.Workspaces, ws)
+	}
+	for _, domain := range s.domains {
+		snap.Domains = append(snap.Domains, domain)
+	}
+	data, err := json.Marshal(snap)
+	s.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("%s: encode snapshot: %w", op, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.snapshotPath), filepath.Base(s.snapshotPath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("%s: create temp file: %w", op, err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("%s: write temp file: %w", op, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("%s: close temp file: %w", op, err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.snapshotPath); err != nil {
+		return fmt.Errorf("%s: rename temp file: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"github.com/raisultan/url-shortener/services/main/internal/lib/logger/handlers/slogdiscard"
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+	"github.com/raisultan/url-shortener/services/main/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		s, err := New(config.Storages{}, context.Background())
+		require.NoError(t, err)
+
+		return s
+	})
+}
+
+func TestStorage_Snapshot(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.Storages{
+		Memory: config.MemoryConfig{SnapshotPath: filepath.Join(t.TempDir(), "snapshot.json")},
+	}
+
+	s, err := New(cfg, ctx)
+	require.NoError(t, err)
+	require.NoError(t, s.SaveUrl(ctx, storage.NewLink(storage.DefaultWorkspace, "snapshot", "https://example.com")))
+	s.Close(ctx, slogdiscard.NewDiscardLogger())
+
+	restored, err := New(cfg, ctx)
+	require.NoError(t, err)
+
+	link, err := restored.GetUrl(ctx, storage.DefaultWorkspace, "snapshot")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com", link.Url)
+}
+
+func TestStorage_UnreadableSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"links": {"plain": 1}}`), 0o644))
+
+	_, err := New(config.Storages{Memory: config.MemoryConfig{SnapshotPath: path}}, context.Background())
+	require.Error(t, err, "a snapshot that can't be read must not start an empty storage")
+}
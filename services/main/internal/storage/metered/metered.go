@@ -0,0 +1,196 @@
+// Package metered wraps a storage to observe latencies of its operations and
+// trace them.
+package metered
+
+import (
+	"context"
+	"time"
+
+	"github.com/raisultan/url-shortener/services/main/internal/metrics"
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"golang.org/x/exp/slog"
+)
+
+type Storage interface {
+	Ping(ctx context.Context) error
+	Close(ctx context.Context, log *slog.Logger)
+	SaveUrl(ctx context.Context, link storage.Link) error
+	SaveUrls(ctx context.Context, links []storage.Link) ([]error, error)
+	GetUrl(ctx context.Context, workspace string, alias string) (storage.Link, error)
+	DeleteUrl(ctx context.Context, workspace string, alias string, owner string) error
+	UpdateUrl(ctx context.Context, workspace string, alias string, url string, owner string) (storage.Link, error)
+	GetUrlHistory(ctx context.Context, workspace string, alias string) ([]storage.HistoryEntry, error)
+	ListUrls(ctx context.Context, filter storage.ListFilter) (storage.LinkPage, error)
+	SaveAPIKey(ctx context.Context, key storage.APIKey) error
+	GetAPIKey(ctx context.Context, hash string) (storage.APIKey, error)
+	SaveWorkspace(ctx context.Context, ws storage.Workspace) error
+	GetWorkspace(ctx context.Context, id string) (storage.Workspace, error)
+	ReserveLinks(ctx context.Context, workspace string, n int) error
+	ReleaseLinks(ctx context.Context, workspace string, n int) error
+	SaveDomain(ctx context.Context, domain storage.Domain) error
+	GetDomain(ctx context.Context, host string) (storage.Domain, error)
+	ListDomains(ctx context.Context, workspace string) ([]storage.Domain, error)
+	DeleteDomain(ctx context.Context, workspace string, host string) error
+}
+
+type Metered struct {
+	next Storage
+}
+
+func New(next Storage) *Metered {
+	return &Metered{next: next}
+}
+
+var tracer = otel.Tracer("github.com/raisultan/url-shortener/services/main/internal/storage/metered")
+
+// observe starts a span of the operation, the returned function ends it and
+// records the latency of the operation.
+func observe(ctx context.Context, operation string) (context.Context, func(err error)) {
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, "storage."+operation)
+
+	return ctx, func(err error) {
+		metrics.StorageDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+func (m *Metered) Ping(ctx context.Context) error {
+	return m.next.Ping(ctx)
+}
+
+func (m *Metered) Close(ctx context.Context, log *slog.Logger) {
+	m.next.Close(ctx, log)
+}
+
+func (m *Metered) SaveUrl(ctx context.Context, link storage.Link) (err error) {
+	ctx, done := observe(ctx, "SaveUrl")
+	defer func() { done(err) }()
+
+	return m.next.SaveUrl(ctx, link)
+}
+
+func (m *Metered) SaveUrls(ctx context.Context, links []storage.Link) (_ []error, err error) {
+	ctx, done := observe(ctx, "SaveUrls")
+	defer func() { done(err) }()
+
+	return m.next.SaveUrls(ctx, links)
+}
+
+func (m *Metered) GetUrl(ctx context.Context, workspace string, alias string) (_ storage.Link, err error) {
+	ctx, done := observe(ctx, "GetUrl")
+	defer func() { done(err) }()
+
+	return m.next.GetUrl(ctx, workspace, alias)
+}
+
+func (m *Metered) DeleteUrl(ctx context.Context, workspace string, alias string, owner string) (err error) {
+	ctx, done := observe(ctx, "DeleteUrl")
+	defer func() { done(err) }()
+
+	return m.next.DeleteUrl(ctx, workspace, alias, owner)
+}
+
+func (m *Metered) UpdateUrl(
+	ctx context.Context,
+	workspace string,
+	alias string,
+	url string,
+	owner string,
+) (_ storage.Link, err error) {
+	ctx, done := observe(ctx, "UpdateUrl")
+	defer func() { done(err) }()
+
+	return m.next.UpdateUrl(ctx, workspace, alias, url, owner)
+}
+
+func (m *Metered) GetUrlHistory(ctx context.Context, workspace string, alias string) (_ []storage.HistoryEntry, err error) {
+	ctx, done := observe(ctx, "GetUrlHistory")
+	defer func() { done(err) }()
+
+	return m.next.GetUrlHistory(ctx, workspace, alias)
+}
+
+func (m *Metered) ListUrls(ctx context.Context, filter storage.ListFilter) (_ storage.LinkPage, err error) {
+	ctx, done := observe(ctx, "ListUrls")
+	defer func() { done(err) }()
+
+	return m.next.ListUrls(ctx, filter)
+}
+
+func (m *Metered) SaveAPIKey(ctx context.Context, key storage.APIKey) (err error) {
+	ctx, done := observe(ctx, "SaveAPIKey")
+	defer func() { done(err) }()
+
+	return m.next.SaveAPIKey(ctx, key)
+}
+
+func (m *Metered) GetAPIKey(ctx context.Context, hash string) (_ storage.APIKey, err error) {
+	ctx, done := observe(ctx, "GetAPIKey")
+	defer func() { done(err) }()
+
+	return m.next.GetAPIKey(ctx, hash)
+}
+
+func (m *Metered) SaveWorkspace(ctx context.Context, ws storage.Workspace) (err error) {
+	ctx, done := observe(ctx, "SaveWorkspace")
+	defer func() { done(err) }()
+
+	return m.next.SaveWorkspace(ctx, ws)
+}
+
+func (m *Metered) GetWorkspace(ctx context.Context, id string) (_ storage.Workspace, err error) {
+	ctx, done := observe(ctx, "GetWorkspace")
+	defer func() { done(err) }()
+
+	return m.next.GetWorkspace(ctx, id)
+}
+
+func (m *Metered) ReserveLinks(ctx context.Context, workspace string, n int) (err error) {
+	ctx, done := observe(ctx, "ReserveLinks")
+	defer func() { done(err) }()
+
+	return m.next.ReserveLinks(ctx, workspace, n)
+}
+
+func (m *Metered) ReleaseLinks(ctx context.Context, workspace string, n int) (err error) {
+	ctx, done := observe(ctx, "ReleaseLinks")
+	defer func() { done(err) }()
+
+	return m.next.ReleaseLinks(ctx, workspace, n)
+}
+
+func (m *Metered) SaveDomain(ctx context.Context, domain storage.Domain) (err error) {
+	ctx, done := observe(ctx, "SaveDomain")
+	defer func() { done(err) }()
+
+	return m.next.SaveDomain(ctx, domain)
+}
+
+func (m *Metered) GetDomain(ctx context.Context, host string) (_ storage.Domain, err error) {
+	ctx, done := observe(ctx, "GetDomain")
+	defer func() { done(err) }()
+
+	return m.next.GetDomain(ctx, host)
+}
+
+func (m *Metered) ListDomains(ctx context.Context, workspace string) (_ []storage.Domain, err error) {
+	ctx, done := observe(ctx, "ListDomains")
+	defer func() { done(err) }()
+
+	return m.next.ListDomains(ctx, workspace)
+}
+
+func (m *Metered) DeleteDomain(ctx context.Context, workspace string, host string) (err error) {
+	ctx, done := observe(ctx, "DeleteDomain")
+	defer func() { done(err) }()
+
+	return m.next.DeleteDomain(ctx, workspace, host)
+}
@@ -11,10 +11,16 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/exp/slog"
+	"strings"
+	"time"
 )
 
 type Storage struct {
-	db *mongo.Collection
+	db         *mongo.Collection
+	history    *mongo.Collection
+	apiKeys    *mongo.Collection
+	workspaces *mongo.Collection
+	domains    *mongo.Collection
 }
 
 func New(
@@ -23,16 +29,150 @@ func New(
 ) (*Storage, error) {
 	const op = "storage.mongo.New"
 
+	if config.Mongo.URI == "" {
+		return nil, fmt.Errorf("%s: uri is not set", op)
+	}
+
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.Mongo.URI))
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
+	database := client.Database(config.Mongo.Database)
+	db := database.Collection(config.Mongo.Collection)
+	history := database.Collection(config.Mongo.HistoryCollection)
+	apiKeys := database.Collection(config.Mongo.APIKeysCollection)
+	workspaces := database.Collection(config.Mongo.WorkspacesCollection)
+	domains := database.Collection(config.Mongo.DomainsCollection)
+
+	err = scopeAliasesToWorkspaces(ctx, db)
+	if err != nil {
+		_ = client.Disconnect(ctx)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = db.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "workspace", Value: 1}, {Key: "alias", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		_ = client.Disconnect(ctx)
+		return nil, fmt.Errorf("%s: create alias index: %w", op, err)
+	}
+
+	_, err = db.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "workspace", Value: 1}, {Key: "owner", Value: 1}, {Key: "alias", Value: 1}}},
+		{Keys: bson.D{{Key: "workspace", Value: 1}, {Key: "target_host", Value: 1}, {Key: "alias", Value: 1}}},
+		{Keys: bson.D{{Key: "workspace", Value: 1}, {Key: "created_at", Value: 1}}},
+	})
+	if err != nil {
+		_ = client.Disconnect(ctx)
+		return nil, fmt.Errorf("%s: create list indexes: %w", op, err)
+	}
+
+	err = backfillTargetHost(ctx, db)
+	if err != nil {
+		_ = client.Disconnect(ctx)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = history.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "workspace", Value: 1}, {Key: "alias", Value: 1}, {Key: "changed_at", Value: -1}},
+	})
+	if err != nil {
+		_ = client.Disconnect(ctx)
+		return nil, fmt.Errorf("%s: create history index: %w", op, err)
+	}
+
+	_, err = apiKeys.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+	})
+	if err != nil {
+		_ = client.Disconnect(ctx)
+		return nil, fmt.Errorf("%s: create api key indexes: %w", op, err)
+	}
+
+	_, err = domains.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "host", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "workspace", Value: 1}, {Key: "host", Value: 1}}},
+	})
+	if err != nil {
+		_ = client.Disconnect(ctx)
+		return nil, fmt.Errorf("%s: create domain index: %w", op, err)
+	}
+
+	_, err = workspaces.UpdateOne(
+		ctx,
+		bson.D{{Key: "_id", Value: storage.DefaultWorkspace}},
+		bson.D{{Key: "$setOnInsert", Value: bson.D{{Key: "created_at", Value: time.Now().UTC()}}}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		_ = client.Disconnect(ctx)
+		return nil, fmt.Errorf("%s: create default workspace: %w", op, err)
+	}
+
 	return &Storage{
-		db: client.Database(config.Mongo.Database).Collection(config.Mongo.Collection),
+		db:         db,
+		history:    history,
+		apiKeys:    apiKeys,
+		workspaces: workspaces,
+		domains:    domains,
 	}, nil
 }
 
+// scopeAliasesToWorkspaces moves urls saved before workspaces existed into
+// the default workspace.
+func scopeAliasesToWorkspaces(ctx context.Context, db *mongo.Collection) error {
+	_, err := db.UpdateMany(
+		ctx,
+		bson.D{{Key: "workspace", Value: bson.D{{Key: "$exists", Value: false}}}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "workspace", Value: storage.DefaultWorkspace}}}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to move urls to the default workspace: %w", err)
+	}
+
+	return nil
+}
+
+// backfillTargetHost fills target_host of urls saved before the field existed.
+func backfillTargetHost(ctx context.Context, db *mongo.Collection) error {
+	cursor, err := db.Find(ctx, bson.D{{Key: "target_host", Value: bson.D{{Key: "$exists", Value: false}}}})
+	if err != nil {
+		return fmt.Errorf("failed to find documents without target host: %w", err)
+	}
+
+	var documents []document
+	if err := cursor.All(ctx, &documents); err != nil {
+		return fmt.Errorf("failed to decode documents without target host: %w", err)
+	}
+
+	for _, d := range documents {
+		_, err := db.UpdateOne(
+			ctx,
+			bson.D{{Key: "workspace", Value: d.Workspace}, {Key: "alias", Value: d.Alias}},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "target_host", Value: storage.UrlHost(d.Url)}}}},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to backfill target host of the alias %s: %w", d.Alias, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	const op = "storage.mongo.Ping"
+
+	if err := s.db.Database().Client().Ping(ctx, nil); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
 func (s *Storage) Close(ctx context.Context, log *slog.Logger) {
 	err := s.db.Database().Client().Disconnect(ctx)
 	if err != nil {
@@ -40,48 +180,558 @@ func (s *Storage) Close(ctx context.Context, log *slog.Logger) {
 	}
 }
 
-func (s *Storage) SaveUrl(ctx context.Context, urlToSave, alias string) error {
-	record := struct {
-		Alias string `bson:"alias"`
-		Url   string `bson:"url"`
-	}{
-		Alias: alias,
-		Url:   urlToSave,
+type document struct {
+	Workspace  string             `bson:"workspace"`
+	Alias      string             `bson:"alias"`
+	Url        string             `bson:"url"`
+	CreatedAt  time.Time          `bson:"created_at"`
+	UpdatedAt  time.Time          `bson:"updated_at"`
+	Owner      string             `bson:"owner,omitempty"`
+	ExpiresAt  time.Time          `bson:"expires_at,omitempty"`
+	Status     storage.LinkStatus `bson:"status"`
+	Metadata   map[string]string  `bson:"metadata,omitempty"`
+	TargetHost string             `bson:"target_host"`
+}
+
+func newDocument(link storage.Link) document {
+	return document{
+		Workspace:  link.Workspace,
+		Alias:      link.Alias,
+		Url:        link.Url,
+		CreatedAt:  link.CreatedAt,
+		UpdatedAt:  link.UpdatedAt,
+		Owner:      link.Owner,
+		ExpiresAt:  link.ExpiresAt,
+		Status:     link.Status,
+		Metadata:   link.Metadata,
+		TargetHost: storage.UrlHost(link.Url),
 	}
+}
 
-	_, err := s.db.InsertOne(ctx, record)
+func (d document) link() storage.Link {
+	status := d.Status
+	if status == "" {
+		status = storage.LinkStatusActive
+	}
+
+	return storage.Link{
+		Workspace: d.Workspace,
+		Alias:     d.Alias,
+		Url:       d.Url,
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt,
+		Owner:     d.Owner,
+		ExpiresAt: d.ExpiresAt,
+		Status:    status,
+		Metadata:  d.Metadata,
+	}
+}
+
+func (s *Storage) SaveUrl(ctx context.Context, link storage.Link) error {
+	_, err := s.db.InsertOne(ctx, newDocument(link))
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to save url with the alias %s: %w", link.Alias, storage.ErrUrlExists)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to save url with the alias %s: %w", alias, err)
+		return fmt.Errorf("failed to save url with the alias %s: %w", link.Alias, err)
 	}
 
 	return nil
 }
 
-func (s *Storage) GetUrl(ctx context.Context, alias string) (string, error) {
-	var result struct {
-		Url string `bson:"url"`
+// SaveUrls saves links with a single unordered bulk write. Links that can't
+// be saved get an error at their index in the returned slice, the others get nil.
+func (s *Storage) SaveUrls(ctx context.Context, links []storage.Link) ([]error, error) {
+	errs := make([]error, len(links))
+	if len(links) == 0 {
+		return errs, nil
+	}
+
+	documents := make([]any, 0, len(links))
+	for _, link := range links {
+		documents = append(documents, newDocument(link))
 	}
 
-	err := s.db.FindOne(ctx, bson.D{{"alias", alias}}).Decode(&result)
+	_, err := s.db.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, writeErr := range bulkErr.WriteErrors {
+			alias := links[writeErr.Index].Alias
+			if mongo.IsDuplicateKeyError(writeErr) {
+				errs[writeErr.Index] = fmt.Errorf(
+					"failed to save url with the alias %s: %w", alias, storage.ErrUrlExists,
+				)
+			} else {
+				errs[writeErr.Index] = fmt.Errorf("failed to save url with the alias %s: %w", alias, writeErr)
+			}
+		}
+
+		return errs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save urls: %w", err)
+	}
+
+	return errs, nil
+}
+
+func (s *Storage) GetUrl(ctx context.Context, workspace string, alias string) (storage.Link, error) {
+	var result document
+
+	err := s.db.FindOne(ctx, linkFilter(workspace, alias)).Decode(&result)
 	if errors.Is(err, mongo.ErrNoDocuments) {
-		return "", storage.ErrUrlNotFound
+		return storage.Link{}, storage.ErrUrlNotFound
 	}
 	if err != nil {
-		return "", fmt.Errorf("failed to find document with the alias %s: %w", alias, err)
+		return storage.Link{}, fmt.Errorf("failed to find document with the alias %s: %w", alias, err)
+	}
+
+	link := result.link()
+	if link.IsExpired() {
+		return storage.Link{}, storage.ErrUrlExpired
 	}
 
-	return result.Url, nil
+	return link, nil
 }
 
-func (s *Storage) DeleteUrl(ctx context.Context, alias string) error {
-	result, err := s.db.DeleteOne(ctx, bson.D{{"alias", alias}})
+type historyDocument struct {
+	Workspace string    `bson:"workspace"`
+	Alias     string    `bson:"alias"`
+	Url       string    `bson:"url"`
+	ChangedAt time.Time `bson:"changed_at"`
+}
+
+// UpdateUrl changes the destination of the link and records the previous
+// one in the history.
+func (s *Storage) UpdateUrl(
+	ctx context.Context,
+	workspace string,
+	alias string,
+	url string,
+	owner string,
+) (storage.Link, error) {
+	now := time.Now().UTC()
+	filter := append(linkFilter(workspace, alias), bson.E{
+		Key: "$or", Value: bson.A{
+			bson.D{{Key: "expires_at", Value: bson.D{{Key: "$exists", Value: false}}}},
+			bson.D{{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: now}}}},
+		},
+	})
+	if owner != "" {
+		filter = append(filter, bson.E{Key: "owner", Value: owner})
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "url", Value: url},
+		{Key: "target_host", Value: storage.UrlHost(url)},
+		{Key: "updated_at", Value: now},
+	}}}
+
+	var previous document
+	err := s.inTransaction(ctx, func(ctx mongo.SessionContext) error {
+		err := s.db.FindOneAndUpdate(
+			ctx,
+			filter,
+			update,
+			options.FindOneAndUpdate().SetReturnDocument(options.Before),
+		).Decode(&previous)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return s.missReason(ctx, workspace, alias, owner)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update document with the alias %s: %w", alias, err)
+		}
+
+		_, err = s.history.InsertOne(ctx, historyDocument{
+			Workspace: workspace,
+			Alias:     alias,
+			Url:       previous.Url,
+			ChangedAt: now,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to save history of the alias %s: %w", alias, err)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to delete document with the alias %s: %w", alias, err)
+		return storage.Link{}, err
 	}
 
-	if result.DeletedCount == 0 {
+	link := previous.link()
+	link.Url = url
+	link.UpdatedAt = now
+
+	return link, nil
+}
+
+// GetUrlHistory returns previous destinations of the link, latest first.
+func (s *Storage) GetUrlHistory(ctx context.Context, workspace string, alias string) ([]storage.HistoryEntry, error) {
+	count, err := s.db.CountDocuments(ctx, linkFilter(workspace, alias))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find document with the alias %s: %w", alias, err)
+	}
+	if count == 0 {
+		return nil, storage.ErrUrlNotFound
+	}
+
+	cursor, err := s.history.Find(
+		ctx,
+		linkFilter(workspace, alias),
+		options.Find().SetSort(bson.D{{Key: "changed_at", Value: -1}, {Key: "_id", Value: -1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find history of the alias %s: %w", alias, err)
+	}
+
+	var documents []historyDocument
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, fmt.Errorf("failed to decode history of the alias %s: %w", alias, err)
+	}
+
+	history := make([]storage.HistoryEntry, 0, len(documents))
+	for _, d := range documents {
+		history = append(history, storage.HistoryEntry{
+			Workspace: d.Workspace,
+			Alias:     d.Alias,
+			Url:       d.Url,
+			ChangedAt: d.ChangedAt,
+		})
+	}
+
+	return history, nil
+}
+
+// ListUrls returns a page of links matching the filter, ordered by alias.
+func (s *Storage) ListUrls(ctx context.Context, filter storage.ListFilter) (storage.LinkPage, error) {
+	query := bson.D{{Key: "workspace", Value: filter.Workspace}}
+	if filter.Owner != "" {
+		query = append(query, bson.E{Key: "owner", Value: filter.Owner})
+	}
+
+	created := bson.D{}
+	if !filter.CreatedFrom.IsZero() {
+		created = append(created, bson.E{Key: "$gte", Value: filter.CreatedFrom})
+	}
+	if !filter.CreatedTo.IsZero() {
+		created = append(created, bson.E{Key: "$lt", Value: filter.CreatedTo})
+	}
+	if len(created) > 0 {
+		query = append(query, bson.E{Key: "created_at", Value: created})
+	}
+
+	if filter.Domain != "" {
+		query = append(query, bson.E{Key: "target_host", Value: strings.ToLower(filter.Domain)})
+	}
+
+	alias := bson.D{}
+	if filter.AliasPrefix != "" {
+		alias = append(
+			alias,
+			bson.E{Key: "$gte", Value: filter.AliasPrefix},
+			bson.E{Key: "$lt", Value: storage.PrefixUpperBound(filter.AliasPrefix)},
+		)
+	}
+	if filter.After != "" {
+		alias = append(alias, bson.E{Key: "$gt", Value: filter.After})
+	}
+	if len(alias) > 0 {
+		query = append(query, bson.E{Key: "alias", Value: alias})
+	}
+
+	// one extra document tells whether there is a next page
+	cursor, err := s.db.Find(
+		ctx,
+		query,
+		options.Find().SetSort(bson.D{{Key: "alias", Value: 1}}).SetLimit(int64(filter.Limit+1)),
+	)
+	if err != nil {
+		return storage.LinkPage{}, fmt.Errorf("failed to find documents: %w", err)
+	}
+
+	var documents []document
+	if err := cursor.All(ctx, &documents); err != nil {
+		return storage.LinkPage{}, fmt.Errorf("failed to decode documents: %w", err)
+	}
+
+	links := make([]storage.Link, 0, len(documents))
+	for _, d := range documents {
+		links = append(links, d.link())
+	}
+
+	return storage.NewLinkPage(links, filter.Limit), nil
+}
+
+// DeleteUrl removes the link together with its history.
+func (s *Storage) DeleteUrl(ctx context.Context, workspace string, alias string, owner string) error {
+	filter := linkFilter(workspace, alias)
+	if owner != "" {
+		filter = append(filter, bson.E{Key: "owner", Value: owner})
+	}
+
+	return s.inTransaction(ctx, func(ctx mongo.SessionContext) error {
+		result, err := s.db.DeleteOne(ctx, filter)
+		if err != nil {
+			return fmt.Errorf("failed to delete document with the alias %s: %w", alias, err)
+		}
+
+		if result.DeletedCount == 0 {
+			// deletes ignore expiry, so an expired owned link was deleted concurrently
+			if err := s.missReason(ctx, workspace, alias, owner); !errors.Is(err, storage.ErrUrlExpired) {
+				return err
+			}
+			return storage.ErrUrlNotFound
+		}
+
+		_, err = s.history.DeleteMany(ctx, linkFilter(workspace, alias))
+		if err != nil {
+			return fmt.Errorf("failed to delete history of the alias %s: %w", alias, err)
+		}
+
+		return nil
+	})
+}
+
+// inTransaction runs fn in a transaction, so links and their history change
+// together. Transactions need a replica set or a sharded cluster.
+func (s *Storage) inTransaction(ctx context.Context, fn func(ctx mongo.SessionContext) error) error {
+	session, err := s.db.Database().Client().StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(ctx)
+	})
+
+	return err
+}
+
+// missReason tells why a filtered write matched no link with the alias.
+func (s *Storage) missReason(ctx context.Context, workspace string, alias string, owner string) error {
+	var d document
+	err := s.db.FindOne(ctx, linkFilter(workspace, alias)).Decode(&d)
+	if errors.Is(err, mongo.ErrNoDocuments) {
 		return storage.ErrUrlNotFound
 	}
+	if err != nil {
+		return fmt.Errorf("failed to find document with the alias %s: %w", alias, err)
+	}
+
+	link := d.link()
+	if !link.OwnedBy(owner) {
+		return storage.ErrUrlNotOwned
+	}
+	if link.IsExpired() {
+		return storage.ErrUrlExpired
+	}
+
+	return storage.ErrUrlNotFound
+}
+
+func linkFilter(workspace string, alias string) bson.D {
+	return bson.D{{Key: "workspace", Value: workspace}, {Key: "alias", Value: alias}}
+}
+
+type apiKeyDocument struct {
+	Hash      string    `bson:"hash"`
+	Name      string    `bson:"name"`
+	Workspace string    `bson:"workspace"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+func (s *Storage) SaveAPIKey(ctx context.Context, key storage.APIKey) error {
+	if _, err := s.GetWorkspace(ctx, key.Workspace); err != nil {
+		return err
+	}
+
+	_, err := s.apiKeys.InsertOne(ctx, apiKeyDocument(key))
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to save api key %s: %w", key.Name, storage.ErrAPIKeyExists)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save api key %s: %w", key.Name, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetAPIKey(ctx context.Context, hash string) (storage.APIKey, error) {
+	var d apiKeyDocument
+	err := s.apiKeys.FindOne(ctx, bson.D{{Key: "hash", Value: hash}}).Decode(&d)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return storage.APIKey{}, storage.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return storage.APIKey{}, fmt.Errorf("failed to find api key: %w", err)
+	}
+
+	key := storage.APIKey(d)
+	key.CreatedAt = key.CreatedAt.UTC()
+
+	return key, nil
+}
+
+type workspaceDocument struct {
+	ID           string    `bson:"_id"`
+	LinkQuota    int       `bson:"link_quota"`
+	LinksCreated int       `bson:"links_created"`
+	CreatedAt    time.Time `bson:"created_at"`
+}
+
+func (s *Storage) SaveWorkspace(ctx context.Context, ws storage.Workspace) error {
+	_, err := s.workspaces.InsertOne(ctx, workspaceDocument(ws))
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to save workspace %s: %w", ws.ID, storage.ErrWorkspaceExists)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save workspace %s: %w", ws.ID, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetWorkspace(ctx context.Context, id string) (storage.Workspace, error) {
+	var d workspaceDocument
+	err := s.workspaces.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&d)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return storage.Workspace{}, storage.ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return storage.Workspace{}, fmt.Errorf("failed to find workspace %s: %w", id, err)
+	}
+
+	ws := storage.Workspace(d)
+	ws.CreatedAt = ws.CreatedAt.UTC()
+
+	return ws, nil
+}
+
+// ReserveLinks counts n links as created in the workspace, unless that
+// exceeds its quota.
+func (s *Storage) ReserveLinks(ctx context.Context, workspace string, n int) error {
+	filter := bson.D{
+		{Key: "_id", Value: workspace},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "link_quota", Value: bson.D{{Key: "$in", Value: bson.A{0, nil}}}}},
+			bson.D{{Key: "$expr", Value: bson.D{{Key: "$lte", Value: bson.A{
+				bson.D{{Key: "$add", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$links_created", 0}}}, n}}},
+				"$link_quota",
+			}}}}},
+		}},
+	}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "links_created", Value: n}}}}
+
+	result, err := s.workspaces.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to reserve links in workspace %s: %w", workspace, err)
+	}
+
+	if result.MatchedCount == 0 {
+		if _, err := s.GetWorkspace(ctx, workspace); err != nil {
+			return err
+		}
+		return storage.ErrQuotaExceeded
+	}
+
+	return nil
+}
+
+// ReleaseLinks gives back n reserved links that were not created after all.
+func (s *Storage) ReleaseLinks(ctx context.Context, workspace string, n int) error {
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.D{{Key: "links_created", Value: bson.D{{Key: "$max", Value: bson.A{
+		bson.D{{Key: "$subtract", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$links_created", 0}}}, n}}},
+		0,
+	}}}}}}}}
+
+	result, err := s.workspaces.UpdateOne(ctx, bson.D{{Key: "_id", Value: workspace}}, update)
+	if err != nil {
+		return fmt.Errorf("failed to release links in workspace %s: %w", workspace, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return storage.ErrWorkspaceNotFound
+	}
+
+	return nil
+}
+
+type domainDocument struct {
+	Host      string    `bson:"host"`
+	Workspace string    `bson:"workspace"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+func (s *Storage) SaveDomain(ctx context.Context, domain storage.Domain) error {
+	if _, err := s.GetWorkspace(ctx, domain.Workspace); err != nil {
+		return err
+	}
+
+	_, err := s.domains.InsertOne(ctx, domainDocument(domain))
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to save domain %s: %w", domain.Host, storage.ErrDomainExists)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save domain %s: %w", domain.Host, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetDomain(ctx context.Context, host string) (storage.Domain, error) {
+	var d domainDocument
+	err := s.domains.FindOne(ctx, bson.D{{Key: "host", Value: host}}).Decode(&d)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return storage.Domain{}, storage.ErrDomainNotFound
+	}
+	if err != nil {
+		return storage.Domain{}, fmt.Errorf("failed to find domain %s: %w", host, err)
+	}
+
+	domain := storage.Domain(d)
+	domain.CreatedAt = domain.CreatedAt.UTC()
+
+	return domain, nil
+}
+
+func (s *Storage) ListDomains(ctx context.Context, workspace string) ([]storage.Domain, error) {
+	cursor, err := s.domains.Find(
+		ctx,
+		bson.D{{Key: "workspace", Value: workspace}},
+		options.Find().SetSort(bson.D{{Key: "host", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find domains of the workspace %s: %w", workspace, err)
+	}
+
+	var documents []domainDocument
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, fmt.Errorf("failed to decode domains of the workspace %s: %w", workspace, err)
+	}
+
+	domains := make([]storage.Domain, 0, len(documents))
+	for _, d := range documents {
+		domain := storage.Domain(d)
+		domain.CreatedAt = domain.CreatedAt.UTC()
+		domains = append(domains, domain)
+	}
+
+	return domains, nil
+}
+
+func (s *Storage) DeleteDomain(ctx context.Context, workspace string, host string) error {
+	result, err := s.domains.DeleteOne(
+		ctx,
+		bson.D{{Key: "workspace", Value: workspace}, {Key: "host", Value: host}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete domain %s: %w", host, err)
+	}
+
+	if result.DeletedCount == 0 {
+		return storage.ErrDomainNotFound
+	}
 
 	return nil
 }
@@ -0,0 +1,41 @@
+package mongo
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"github.com/raisultan/url-shortener/services/main/internal/lib/logger/handlers/slogdiscard"
+	"github.com/raisultan/url-shortener/services/main/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStorage runs against the server given by STORAGETEST_MONGO_URI,
+// see `make run-storage-tests`.
+func TestStorage(t *testing.T) {
+	uri := os.Getenv("STORAGETEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("STORAGETEST_MONGO_URI is not set")
+	}
+
+	cfg := config.Storages{
+		Mongo: config.MongoConfig{
+			URI:                  uri,
+			Database:             "storagetest",
+			Collection:           "urls",
+			HistoryCollection:    "url_history",
+			APIKeysCollection:    "api_keys",
+			WorkspacesCollection: "workspaces",
+			DomainsCollection:    "domains",
+		},
+	}
+
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		s, err := New(cfg, context.Background())
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close(context.Background(), slogdiscard.NewDiscardLogger()) })
+
+		return s
+	})
+}
@@ -0,0 +1,729 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/raisultan/url-shortener/lib/logger/sl"
+	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+	"golang.org/x/exp/slog"
+)
+
+// uniqueViolation is the PostgreSQL error code for unique constraint violations.
+const uniqueViolation = "23505"
+
+type Storage struct {
+	db *sql.DB
+}
+
+func New(config config.Storages, ctx context.Context) (*Storage, error) {
+	const op = "storage.postgres.New"
+
+	cfg := config.Postgres
+	psqlInfo := fmt.Sprintf(
+		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode,
+	)
+	db, err := sql.Open("postgres", psqlInfo)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	createTableIfDoesNotExistStmt := `
+		CREATE TABLE IF NOT EXISTS url(
+			id BIGSERIAL PRIMARY KEY,
+			workspace TEXT NOT NULL DEFAULT 'default',
+			alias TEXT NOT NULL,
+			url TEXT NOT NULL,
+			target_host TEXT NOT NULL DEFAULT '',
+			owner TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL DEFAULT 'active',
+			metadata JSONB,
+			expires_at TIMESTAMPTZ,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			UNIQUE (workspace, alias));
+		-- lookups by alias compare in the default collation and use the unique
+		-- index, the index in "C" only serves the order of listings
+		CREATE INDEX IF NOT EXISTS idx_url_workspace_alias_c ON url(workspace, alias COLLATE "C");
+		CREATE INDEX IF NOT EXISTS idx_url_workspace_owner ON url(workspace, owner, alias COLLATE "C");
+		CREATE INDEX IF NOT EXISTS idx_url_workspace_target_host ON url(workspace, target_host, alias COLLATE "C");
+		CREATE INDEX IF NOT EXISTS idx_url_workspace_created_at ON url(workspace, created_at);
+		CREATE TABLE IF NOT EXISTS url_history(
+			id BIGSERIAL PRIMARY KEY,
+			workspace TEXT NOT NULL DEFAULT 'default',
+			alias TEXT NOT NULL,
+			url TEXT NOT NULL,
+			changed_at TIMESTAMPTZ NOT NULL);
+		CREATE INDEX IF NOT EXISTS idx_url_history_workspace_alias ON url_history(workspace, alias);
+		CREATE TABLE IF NOT EXISTS api_key(
+			hash TEXT PRIMARY KEY,
+			workspace TEXT NOT NULL DEFAULT 'default',
+			name TEXT NOT NULL UNIQUE,
+			created_at TIMESTAMPTZ NOT NULL);
+		CREATE TABLE IF NOT EXISTS workspace(
+			id TEXT PRIMARY KEY,
+			link_quota INTEGER NOT NULL DEFAULT 0,
+			links_created INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMPTZ NOT NULL);
+		INSERT INTO workspace(id, created_at) VALUES('default', now()) ON CONFLICT DO NOTHING;
+		CREATE TABLE IF NOT EXISTS domain(
+			host TEXT PRIMARY KEY,
+			workspace TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL);
+		CREATE INDEX IF NOT EXISTS idx_domain_workspace ON domain(workspace, host COLLATE "C");
+	`
+	_, err = db.ExecContext(ctx, createTableIfDoesNotExistStmt)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Storage{db: db}, nil
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	const op = "storage.postgres.Ping"
+
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Close(_ context.Context, log *slog.Logger) {
+	err := s.db.Close()
+	if err != nil {
+		log.Error("could not close storage", sl.Err(err))
+	}
+}
+
+func (s *Storage) SaveUrl(ctx context.Context, link storage.Link) error {
+	const op = "storage.postgres.SaveUrl"
+
+	args, err := insertLinkArgs(link)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = s.db.ExecContext(ctx, insertLinkStmt, args...)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return fmt.Errorf("%s: %w", op, storage.ErrUrlExists)
+		}
+
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return nil
+}
+
+// SaveUrls saves links in a single transaction. Links that can't be saved
+// get an error at their index in the returned slice, the others get nil.
+func (s *Storage) SaveUrls(ctx context.Context, links []storage.Link) ([]error, error) {
+	const op = "storage.postgres.SaveUrls"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: begin transaction: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// a failed statement aborts the whole PostgreSQL transaction, so
+	// duplicates are skipped by the statement instead of failing it
+	stmt, err := tx.PrepareContext(ctx, insertLinkStmt+" ON CONFLICT (workspace, alias) DO NOTHING")
+	if err != nil {
+		return nil, fmt.Errorf("%s: prepare statement: %w", op, err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	errs := make([]error, len(links))
+	for i, link := range links {
+		args, err := insertLinkArgs(link)
+		if err != nil {
+			errs[i] = fmt.Errorf("%s: %w", op, err)
+			continue
+		}
+
+		result, err := stmt.ExecContext(ctx, args...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: execute statement: %w", op, err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("%s: check affected rows: %w", op, err)
+		}
+		if rowsAffected == 0 {
+			errs[i] = fmt.Errorf("%s: %w", op, storage.ErrUrlExists)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: commit transaction: %w", op, err)
+	}
+
+	return errs, nil
+}
+
+const insertLinkStmt = `
+	INSERT INTO url(workspace, alias, url, created_at, updated_at, owner, expires_at, status, metadata, target_host)
+	VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+func insertLinkArgs(link storage.Link) ([]any, error) {
+	metadata, err := encodeMetadata(link.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return []any{
+		link.Workspace,
+		link.Alias,
+		link.Url,
+		link.CreatedAt,
+		link.UpdatedAt,
+		link.Owner,
+		sql.NullTime{Time: link.ExpiresAt, Valid: !link.ExpiresAt.IsZero()},
+		link.Status,
+		metadata,
+		storage.UrlHost(link.Url),
+	}, nil
+}
+
+func (s *Storage) GetUrl(ctx context.Context, workspace string, alias string) (storage.Link, error) {
+	const op = "storage.postgres.GetUrl"
+
+	row := s.db.QueryRowContext(
+		ctx,
+		"SELECT "+linkColumns+" FROM url WHERE workspace = $1 AND alias = $2",
+		workspace, alias,
+	)
+	link, err := scanLink(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Link{}, storage.ErrUrlNotFound
+	}
+	if err != nil {
+		return storage.Link{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	if link.IsExpired() {
+		return storage.Link{}, storage.ErrUrlExpired
+	}
+
+	return link, nil
+}
+
+// UpdateUrl changes the destination of the link and records the previous
+// one in the history.
+func (s *Storage) UpdateUrl(
+	ctx context.Context,
+	workspace string,
+	alias string,
+	url string,
+	owner string,
+) (storage.Link, error) {
+	const op = "storage.postgres.UpdateUrl"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return storage.Link{}, fmt.Errorf("%s: begin transaction: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	row := tx.QueryRowContext(
+		ctx,
+		"SELECT "+linkColumns+" FROM url WHERE workspace = $1 AND alias = $2 FOR UPDATE",
+		workspace, alias,
+	)
+	link, err := scanLink(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Link{}, storage.ErrUrlNotFound
+	}
+	if err != nil {
+		return storage.Link{}, fmt.Errorf("%s: select url: %w", op, err)
+	}
+
+	if !link.OwnedBy(owner) {
+		return storage.Link{}, storage.ErrUrlNotOwned
+	}
+
+	if link.IsExpired() {
+		return storage.Link{}, storage.ErrUrlExpired
+	}
+
+	now := time.Now().UTC()
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO url_history(workspace, alias, url, changed_at) VALUES($1, $2, $3, $4)",
+		workspace, alias, link.Url, now,
+	)
+	if err != nil {
+		return storage.Link{}, fmt.Errorf("%s: insert history: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE url SET url = $1, target_host = $2, updated_at = $3 WHERE workspace = $4 AND alias = $5",
+		url, storage.UrlHost(url), now, workspace, alias,
+	)
+	if err != nil {
+		return storage.Link{}, fmt.Errorf("%s: update url: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return storage.Link{}, fmt.Errorf("%s: commit transaction: %w", op, err)
+	}
+
+	link.Url = url
+	link.UpdatedAt = now
+
+	return link, nil
+}
+
+// GetUrlHistory returns previous destinations of the link, latest first.
+func (s *Storage) GetUrlHistory(ctx context.Context, workspace string, alias string) ([]storage.HistoryEntry, error) {
+	const op = "storage.postgres.GetUrlHistory"
+
+	var exists int
+	err := s.db.QueryRowContext(
+		ctx,
+		"SELECT 1 FROM url WHERE workspace = $1 AND alias = $2",
+		workspace, alias,
+	).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrUrlNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: select url: %w", op, err)
+	}
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT workspace, alias, url, changed_at FROM url_history WHERE workspace = $1 AND alias = $2 ORDER BY id DESC",
+		workspace, alias,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: select history: %w", op, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	history := []storage.HistoryEntry{}
+	for rows.Next() {
+		var entry storage.HistoryEntry
+		if err := rows.Scan(&entry.Workspace, &entry.Alias, &entry.Url, &entry.ChangedAt); err != nil {
+			return nil, fmt.Errorf("%s: scan history: %w", op, err)
+		}
+		history = append(history, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: select history: %w", op, err)
+	}
+
+	return history, nil
+}
+
+// ListUrls returns a page of links matching the filter, ordered by alias in
+// byte order, which the "C" collation provides regardless of database locale.
+func (s *Storage) ListUrls(ctx context.Context, filter storage.ListFilter) (storage.LinkPage, error) {
+	const op = "storage.postgres.ListUrls"
+
+	var conditions []string
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions = append(conditions, "workspace = "+arg(filter.Workspace))
+	if filter.Owner != "" {
+		conditions = append(conditions, "owner = "+arg(filter.Owner))
+	}
+	if !filter.CreatedFrom.IsZero() {
+		conditions = append(conditions, "created_at >= "+arg(filter.CreatedFrom))
+	}
+	if !filter.CreatedTo.IsZero() {
+		conditions = append(conditions, "created_at < "+arg(filter.CreatedTo))
+	}
+	if filter.Domain != "" {
+		conditions = append(conditions, "target_host = "+arg(strings.ToLower(filter.Domain)))
+	}
+	if filter.AliasPrefix != "" {
+		conditions = append(conditions, fmt.Sprintf(
+			`alias COLLATE "C" >= %s AND alias COLLATE "C" < %s`,
+			arg(filter.AliasPrefix), arg(storage.PrefixUpperBound(filter.AliasPrefix)),
+		))
+	}
+	if filter.After != "" {
+		conditions = append(conditions, `alias COLLATE "C" > `+arg(filter.After))
+	}
+
+	query := "SELECT " + linkColumns + " FROM url WHERE " + strings.Join(conditions, " AND ")
+	// one extra row tells whether there is a next page
+	query += ` ORDER BY alias COLLATE "C" LIMIT ` + arg(filter.Limit+1)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return storage.LinkPage{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	links := []storage.Link{}
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return storage.LinkPage{}, fmt.Errorf("%s: scan url: %w", op, err)
+		}
+		links = append(links, link)
+	}
+	if err := rows.Err(); err != nil {
+		return storage.LinkPage{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return storage.NewLinkPage(links, filter.Limit), nil
+}
+
+// DeleteUrl removes the link together with its history.
+func (s *Storage) DeleteUrl(ctx context.Context, workspace string, alias string, owner string) error {
+	const op = "storage.postgres.DeleteUrl"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: begin transaction: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var linkOwner string
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT owner FROM url WHERE workspace = $1 AND alias = $2 FOR UPDATE",
+		workspace, alias,
+	).Scan(&linkOwner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrUrlNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("%s: select url: %w", op, err)
+	}
+
+	if !storage.IsOwner(linkOwner, owner) {
+		return storage.ErrUrlNotOwned
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM url WHERE workspace = $1 AND alias = $2", workspace, alias)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM url_history WHERE workspace = $1 AND alias = $2", workspace, alias)
+	if err != nil {
+		return fmt.Errorf("%s: delete history: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit transaction: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) SaveAPIKey(ctx context.Context, key storage.APIKey) error {
+	const op = "storage.postgres.SaveAPIKey"
+
+	result, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO api_key(hash, name, workspace, created_at)
+		SELECT $1, $2, $3, $4::timestamptz WHERE EXISTS (SELECT 1 FROM workspace WHERE id = $3)`,
+		key.Hash, key.Name, key.Workspace, key.CreatedAt.UTC(),
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return fmt.Errorf("%s: %w", op, storage.ErrAPIKeyExists)
+		}
+
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return requireWorkspace(result, op)
+}
+
+func (s *Storage) GetAPIKey(ctx context.Context, hash string) (storage.APIKey, error) {
+	const op = "storage.postgres.GetAPIKey"
+
+	var key storage.APIKey
+	err := s.db.QueryRowContext(
+		ctx,
+		"SELECT hash, name, workspace, created_at FROM api_key WHERE hash = $1",
+		hash,
+	).Scan(&key.Hash, &key.Name, &key.Workspace, &key.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.APIKey{}, storage.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return storage.APIKey{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	key.CreatedAt = key.CreatedAt.UTC()
+
+	return key, nil
+}
+
+// requireWorkspace maps statements that touched no rows because the workspace
+// doesn't exist to ErrWorkspaceNotFound.
+func requireWorkspace(result sql.Result, op string) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: check affected rows: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		return storage.ErrWorkspaceNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) SaveWorkspace(ctx context.Context, ws storage.Workspace) error {
+	const op = "storage.postgres.SaveWorkspace"
+
+	_, err := s.db.ExecContext(
+		ctx,
+		"INSERT INTO workspace(id, link_quota, links_created, created_at) VALUES($1, $2, $3, $4)",
+		ws.ID, ws.LinkQuota, ws.LinksCreated, ws.CreatedAt.UTC(),
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return fmt.Errorf("%s: %w", op, storage.ErrWorkspaceExists)
+		}
+
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetWorkspace(ctx context.Context, id string) (storage.Workspace, error) {
+	const op = "storage.postgres.GetWorkspace"
+
+	var ws storage.Workspace
+	err := s.db.QueryRowContext(
+		ctx,
+		"SELECT id, link_quota, links_created, created_at FROM workspace WHERE id = $1",
+		id,
+	).Scan(&ws.ID, &ws.LinkQuota, &ws.LinksCreated, &ws.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Workspace{}, storage.ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return storage.Workspace{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	ws.CreatedAt = ws.CreatedAt.UTC()
+
+	return ws, nil
+}
+
+// ReserveLinks counts n links as created in the workspace, unless that
+// exceeds its quota.
+func (s *Storage) ReserveLinks(ctx context.Context, workspace string, n int) error {
+	const op = "storage.postgres.ReserveLinks"
+
+	result, err := s.db.ExecContext(
+		ctx,
+		`UPDATE workspace SET links_created = links_created + $1
+		WHERE id = $2 AND (link_quota = 0 OR links_created + $1 <= link_quota)`,
+		n, workspace,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: check affected rows: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		if _, err := s.GetWorkspace(ctx, workspace); err != nil {
+			return err
+		}
+		return storage.ErrQuotaExceeded
+	}
+
+	return nil
+}
+
+// ReleaseLinks gives back n reserved links that were not created after all.
+func (s *Storage) ReleaseLinks(ctx context.Context, workspace string, n int) error {
+	const op = "storage.postgres.ReleaseLinks"
+
+	result, err := s.db.ExecContext(
+		ctx,
+		"UPDATE workspace SET links_created = GREATEST(links_created - $1, 0) WHERE id = $2",
+		n, workspace,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return requireWorkspace(result, op)
+}
+
+func (s *Storage) SaveDomain(ctx context.Context, domain storage.Domain) error {
+	const op = "storage.postgres.SaveDomain"
+
+	result, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO domain(host, workspace, created_at)
+		SELECT $1, $2, $3::timestamptz WHERE EXISTS (SELECT 1 FROM workspace WHERE id = $2)`,
+		domain.Host, domain.Workspace, domain.CreatedAt.UTC(),
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return fmt.Errorf("%s: %w", op, storage.ErrDomainExists)
+		}
+
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return requireWorkspace(result, op)
+}
+
+func (s *Storage) GetDomain(ctx context.Context, host string) (storage.Domain, error) {
+	const op = "storage.postgres.GetDomain"
+
+	var domain storage.Domain
+	err := s.db.QueryRowContext(
+		ctx,
+		"SELECT host, workspace, created_at FROM domain WHERE host = $1",
+		host,
+	).Scan(&domain.Host, &domain.Workspace, &domain.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Domain{}, storage.ErrDomainNotFound
+	}
+	if err != nil {
+		return storage.Domain{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	domain.CreatedAt = domain.CreatedAt.UTC()
+
+	return domain, nil
+}
+
+func (s *Storage) ListDomains(ctx context.Context, workspace string) ([]storage.Domain, error) {
+	const op = "storage.postgres.ListDomains"
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT host, workspace, created_at FROM domain WHERE workspace = $1 ORDER BY host COLLATE "C"`,
+		workspace,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	domains := []storage.Domain{}
+	for rows.Next() {
+		var domain storage.Domain
+		if err := rows.Scan(&domain.Host, &domain.Workspace, &domain.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+		domain.CreatedAt = domain.CreatedAt.UTC()
+		domains = append(domains, domain)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: iterate rows: %w", op, err)
+	}
+
+	return domains, nil
+}
+
+func (s *Storage) DeleteDomain(ctx context.Context, workspace string, host string) error {
+	const op = "storage.postgres.DeleteDomain"
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM domain WHERE workspace = $1 AND host = $2", workspace, host)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: check affected rows: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrDomainNotFound
+	}
+
+	return nil
+}
+
+const linkColumns = "workspace, alias, url, created_at, updated_at, owner, expires_at, status, metadata"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanLink(row rowScanner) (storage.Link, error) {
+	var link storage.Link
+	var expiresAt sql.NullTime
+	var metadata []byte
+
+	err := row.Scan(
+		&link.Workspace,
+		&link.Alias,
+		&link.Url,
+		&link.CreatedAt,
+		&link.UpdatedAt,
+		&link.Owner,
+		&expiresAt,
+		&link.Status,
+		&metadata,
+	)
+	if err != nil {
+		return storage.Link{}, err
+	}
+
+	link.ExpiresAt = expiresAt.Time
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &link.Metadata); err != nil {
+			return storage.Link{}, fmt.Errorf("decode metadata: %w", err)
+		}
+	}
+
+	return link, nil
+}
+
+func encodeMetadata(metadata map[string]string) ([]byte, error) {
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("encode metadata: %w", err)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"github.com/raisultan/url-shortener/services/main/internal/lib/logger/handlers/slogdiscard"
+	"github.com/raisultan/url-shortener/services/main/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStorage runs against the database given by STORAGETEST_POSTGRES_HOST,
+// see `make run-storage-tests`.
+func TestStorage(t *testing.T) {
+	host := os.Getenv("STORAGETEST_POSTGRES_HOST")
+	if host == "" {
+		t.Skip("STORAGETEST_POSTGRES_HOST is not set")
+	}
+
+	port, err := strconv.Atoi(os.Getenv("STORAGETEST_POSTGRES_PORT"))
+	if err != nil {
+		port = 5432
+	}
+
+	cfg := config.Storages{
+		Postgres: config.PostgresConfig{
+			Host:            host,
+			Port:            port,
+			User:            os.Getenv("STORAGETEST_POSTGRES_USER"),
+			Password:        os.Getenv("STORAGETEST_POSTGRES_PASSWORD"),
+			DBName:          os.Getenv("STORAGETEST_POSTGRES_DBNAME"),
+			SSLMode:         "disable",
+			MaxOpenConns:    5,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: time.Minute,
+			ConnMaxIdleTime: time.Minute,
+		},
+	}
+
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		s, err := New(cfg, context.Background())
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close(context.Background(), slogdiscard.NewDiscardLogger()) })
+
+		return s
+	})
+}
@@ -3,12 +3,15 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/raisultan/url-shortener/lib/logger/sl"
 	"github.com/raisultan/url-shortener/services/main/internal/config"
 	"github.com/raisultan/url-shortener/services/main/internal/storage"
 	"golang.org/x/exp/slog"
+	"strings"
+	"time"
 
 	"github.com/mattn/go-sqlite3"
 )
@@ -20,30 +23,219 @@ type Storage struct {
 func New(config config.Storages, _ context.Context) (*Storage, error) {
 	const op = "storage.sqlite.New"
 
+	if config.SQLite.StoragePath == "" {
+		return nil, fmt.Errorf("%s: storage path is not set", op)
+	}
+
 	db, err := sql.Open("sqlite3", config.SQLite.StoragePath)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	stmt, err := db.Prepare(`
+	// Exec runs every statement, unlike a prepared statement which stops after the first one.
+	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS url(
 			id INTEGER PRIMARY KEY,
-			alias TEXT NOT NULL UNIQUE,
-			url TEXT NOT NULL);
-		CREATE INDEX IF NOT EXISTS idx_alias ON url(alias);
+			workspace TEXT NOT NULL DEFAULT 'default',
+			alias TEXT NOT NULL,
+			url TEXT NOT NULL,
+			UNIQUE(workspace, alias));
+		CREATE TABLE IF NOT EXISTS url_history(
+			id INTEGER PRIMARY KEY,
+			alias TEXT NOT NULL,
+			url TEXT NOT NULL,
+			changed_at TIMESTAMP NOT NULL);
+		CREATE TABLE IF NOT EXISTS api_key(
+			hash TEXT PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			created_at TIMESTAMP NOT NULL);
+		CREATE TABLE IF NOT EXISTS workspace(
+			id TEXT PRIMARY KEY,
+			link_quota INTEGER NOT NULL DEFAULT 0,
+			links_created INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NOT NULL);
+		CREATE TABLE IF NOT EXISTS domain(
+			host TEXT PRIMARY KEY,
+			workspace TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL);
+		CREATE INDEX IF NOT EXISTS idx_domain_workspace ON domain(workspace, host);
 	`)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	defer func() { _ = stmt.Close() }()
 
-	_, err = stmt.Exec()
+	columns := []struct{ table, name, definition string }{
+		{"url", "workspace", "TEXT NOT NULL DEFAULT 'default'"},
+		{"url", "expires_at", "TIMESTAMP"},
+		{"url", "created_at", "TIMESTAMP"},
+		{"url", "updated_at", "TIMESTAMP"},
+		{"url", "owner", "TEXT NOT NULL DEFAULT ''"},
+		{"url", "status", "TEXT NOT NULL DEFAULT 'active'"},
+		{"url", "metadata", "TEXT"},
+		{"url", "target_host", "TEXT NOT NULL DEFAULT ''"},
+		{"url_history", "workspace", "TEXT NOT NULL DEFAULT 'default'"},
+		{"api_key", "workspace", "TEXT NOT NULL DEFAULT 'default'"},
+	}
+	for _, column := range columns {
+		err = addColumnIfNotExists(db, column.table, column.name, column.definition)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	err = scopeAliasesToWorkspaces(db)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_url_owner ON url(workspace, owner, alias);
+		CREATE INDEX IF NOT EXISTS idx_url_target_host ON url(workspace, target_host, alias);
+		CREATE INDEX IF NOT EXISTS idx_url_created_at ON url(workspace, created_at);
+		DROP INDEX IF EXISTS idx_url_history_alias;
+		CREATE INDEX IF NOT EXISTS idx_url_history_workspace_alias ON url_history(workspace, alias);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = db.Exec(
+		"INSERT OR IGNORE INTO workspace(id, created_at) VALUES(?, ?)",
+		storage.DefaultWorkspace, time.Now().UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: create default workspace: %w", op, err)
+	}
+
+	err = backfillTargetHost(db)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+
 	return &Storage{db: db}, nil
 }
 
+// backfillTargetHost fills target_host of urls saved before the column existed.
+func backfillTargetHost(db *sql.DB) error {
+	rows, err := db.Query("SELECT id, url FROM url WHERE target_host = ''")
+	if err != nil {
+		return fmt.Errorf("select urls without target host: %w", err)
+	}
+
+	hosts := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var url string
+		if err := rows.Scan(&id, &url); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("select urls without target host: %w", err)
+		}
+		if host := storage.UrlHost(url); host != "" {
+			hosts[id] = host
+		}
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("select urls without target host: %w", err)
+	}
+
+	for id, host := range hosts {
+		_, err := db.Exec("UPDATE url SET target_host = ? WHERE id = ?", host, id)
+		if err != nil {
+			return fmt.Errorf("backfill target host: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// scopeAliasesToWorkspaces rebuilds url tables created by older versions with
+// globally unique aliases, SQLite can't drop a column constraint in place.
+func scopeAliasesToWorkspaces(db *sql.DB) error {
+	var schema string
+	err := db.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'url'").Scan(&schema)
+	if err != nil {
+		return fmt.Errorf("read url schema: %w", err)
+	}
+
+	if !strings.Contains(schema, "alias TEXT NOT NULL UNIQUE") {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("scope aliases to workspaces: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(`
+		CREATE TABLE url_workspaces(
+			id INTEGER PRIMARY KEY,
+			workspace TEXT NOT NULL DEFAULT 'default',
+			alias TEXT NOT NULL,
+			url TEXT NOT NULL,
+			expires_at TIMESTAMP,
+			created_at TIMESTAMP,
+			updated_at TIMESTAMP,
+			owner TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL DEFAULT 'active',
+			metadata TEXT,
+			target_host TEXT NOT NULL DEFAULT '',
+			UNIQUE(workspace, alias));
+		INSERT INTO url_workspaces(
+			id, workspace, alias, url, expires_at, created_at, updated_at, owner, status, metadata, target_host)
+		SELECT id, workspace, alias, url, expires_at, created_at, updated_at, owner, status, metadata, target_host
+		FROM url;
+		DROP TABLE url;
+		ALTER TABLE url_workspaces RENAME TO url;
+	`)
+	if err != nil {
+		return fmt.Errorf("scope aliases to workspaces: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// addColumnIfNotExists brings tables created by older versions up to date,
+// SQLite has no ADD COLUMN IF NOT EXISTS.
+func addColumnIfNotExists(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", table))
+	if err != nil {
+		return fmt.Errorf("list columns of %s: %w", table, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("list columns of %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("list columns of %s: %w", table, err)
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("add column %s.%s: %w", table, column, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	const op = "storage.sqlite.Ping"
+
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
 func (s *Storage) Close(_ context.Context, log *slog.Logger) {
 	err := s.db.Close()
 	if err != nil {
@@ -51,70 +243,616 @@ func (s *Storage) Close(_ context.Context, log *slog.Logger) {
 	}
 }
 
-func (s *Storage) SaveUrl(_ context.Context, urlToSave string, alias string) error {
+func (s *Storage) SaveUrl(ctx context.Context, link storage.Link) error {
 	const op = "storage.sqlite.SaveUrl"
 
-	stmt, err := s.db.Prepare("INSERT INTO url(url, alias) VALUES(?, ?)")
+	args, err := insertLinkArgs(link)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
+
+	stmt, err := s.db.PrepareContext(ctx, insertLinkStmt)
+	if err != nil {
+		return fmt.Errorf("%s: prepare statement: %w", op, err)
+	}
 	defer func() { _ = stmt.Close() }()
 
-	_, err = stmt.Exec(urlToSave, alias)
+	_, err = stmt.ExecContext(ctx, args...)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%s: %w", op, storage.ErrUrlExists)
+	}
 	if err != nil {
-		var sqliteErr sqlite3.Error
-		ok := errors.As(err, &sqliteErr)
-		if ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
-			return fmt.Errorf("%s: %w", op, storage.ErrUrlExists)
-		}
+		return fmt.Errorf("%s: execute statement: %w", op, err)
 	}
 
 	return nil
 }
 
-func (s *Storage) GetUrl(_ context.Context, alias string) (string, error) {
+// SaveUrls saves links in a single transaction. Links that can't be saved
+// get an error at their index in the returned slice, the others get nil.
+func (s *Storage) SaveUrls(ctx context.Context, links []storage.Link) ([]error, error) {
+	const op = "storage.sqlite.SaveUrls"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: begin transaction: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.PrepareContext(ctx, insertLinkStmt)
+	if err != nil {
+		return nil, fmt.Errorf("%s: prepare statement: %w", op, err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	errs := make([]error, len(links))
+	for i, link := range links {
+		args, err := insertLinkArgs(link)
+		if err != nil {
+			errs[i] = fmt.Errorf("%s: %w", op, err)
+			continue
+		}
+
+		// a failed statement doesn't abort the SQLite transaction
+		_, err = stmt.ExecContext(ctx, args...)
+		if isUniqueViolation(err) {
+			errs[i] = fmt.Errorf("%s: %w", op, storage.ErrUrlExists)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: execute statement: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: commit transaction: %w", op, err)
+	}
+
+	return errs, nil
+}
+
+const insertLinkStmt = `
+	INSERT INTO url(workspace, alias, url, created_at, updated_at, owner, expires_at, status, metadata, target_host)
+	VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+func insertLinkArgs(link storage.Link) ([]any, error) {
+	metadata, err := encodeMetadata(link.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return []any{
+		link.Workspace,
+		link.Alias,
+		link.Url,
+		link.CreatedAt.UTC(),
+		link.UpdatedAt.UTC(),
+		link.Owner,
+		nullTime(link.ExpiresAt),
+		link.Status,
+		metadata,
+		storage.UrlHost(link.Url),
+	}, nil
+}
+
+// isUniqueViolation reports unique and primary key constraint violations,
+// SQLite tells them apart for tables with non-integer primary keys.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+
+	return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+		sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+}
+
+func (s *Storage) GetUrl(ctx context.Context, workspace string, alias string) (storage.Link, error) {
 	const op = "storage.sqlite.GetUrl"
 
-	stmt, err := s.db.Prepare("SELECT url FROM url WHERE alias = ?")
+	stmt, err := s.db.PrepareContext(ctx, "SELECT "+linkColumns+" FROM url WHERE workspace = ? AND alias = ?")
 	if err != nil {
-		return "", fmt.Errorf("%s: prepare statement %w", op, err)
+		return storage.Link{}, fmt.Errorf("%s: prepare statement %w", op, err)
 	}
 	defer func() { _ = stmt.Close() }()
 
-	var resUrl string
-	err = stmt.QueryRow(alias).Scan(&resUrl)
+	link, err := scanLink(stmt.QueryRowContext(ctx, workspace, alias))
 	if errors.Is(err, sql.ErrNoRows) {
-		return "", storage.ErrUrlNotFound
+		return storage.Link{}, storage.ErrUrlNotFound
 	}
 	if err != nil {
-		return "", fmt.Errorf("%s: execute statement: %w", op, err)
+		return storage.Link{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	if link.IsExpired() {
+		return storage.Link{}, storage.ErrUrlExpired
 	}
 
-	return resUrl, nil
+	return link, nil
 }
 
-func (s *Storage) DeleteUrl(_ context.Context, alias string) error {
+// UpdateUrl changes the destination of the link and records the previous
+// one in the history.
+func (s *Storage) UpdateUrl(
+	ctx context.Context,
+	workspace string,
+	alias string,
+	url string,
+	owner string,
+) (storage.Link, error) {
+	const op = "storage.sqlite.UpdateUrl"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return storage.Link{}, fmt.Errorf("%s: begin transaction: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	link, err := scanLink(tx.QueryRowContext(
+		ctx,
+		"SELECT "+linkColumns+" FROM url WHERE workspace = ? AND alias = ?",
+		workspace, alias,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Link{}, storage.ErrUrlNotFound
+	}
+	if err != nil {
+		return storage.Link{}, fmt.Errorf("%s: select url: %w", op, err)
+	}
+
+	if !link.OwnedBy(owner) {
+		return storage.Link{}, storage.ErrUrlNotOwned
+	}
+
+	if link.IsExpired() {
+		return storage.Link{}, storage.ErrUrlExpired
+	}
+
+	now := time.Now().UTC()
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO url_history(workspace, alias, url, changed_at) VALUES(?, ?, ?, ?)",
+		workspace, alias, link.Url, now,
+	)
+	if err != nil {
+		return storage.Link{}, fmt.Errorf("%s: insert history: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE url SET url = ?, target_host = ?, updated_at = ? WHERE workspace = ? AND alias = ?",
+		url, storage.UrlHost(url), now, workspace, alias,
+	)
+	if err != nil {
+		return storage.Link{}, fmt.Errorf("%s: update url: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return storage.Link{}, fmt.Errorf("%s: commit transaction: %w", op, err)
+	}
+
+	link.Url = url
+	link.UpdatedAt = now
+
+	return link, nil
+}
+
+// GetUrlHistory returns previous destinations of the link, latest first.
+func (s *Storage) GetUrlHistory(ctx context.Context, workspace string, alias string) ([]storage.HistoryEntry, error) {
+	const op = "storage.sqlite.GetUrlHistory"
+
+	var exists int
+	err := s.db.QueryRowContext(
+		ctx,
+		"SELECT 1 FROM url WHERE workspace = ? AND alias = ?",
+		workspace, alias,
+	).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrUrlNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: select url: %w", op, err)
+	}
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT workspace, alias, url, changed_at FROM url_history WHERE workspace = ? AND alias = ? ORDER BY id DESC",
+		workspace, alias,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: select history: %w", op, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	history := []storage.HistoryEntry{}
+	for rows.Next() {
+		var entry storage.HistoryEntry
+		if err := rows.Scan(&entry.Workspace, &entry.Alias, &entry.Url, &entry.ChangedAt); err != nil {
+			return nil, fmt.Errorf("%s: scan history: %w", op, err)
+		}
+		history = append(history, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: select history: %w", op, err)
+	}
+
+	return history, nil
+}
+
+// ListUrls returns a page of links matching the filter, ordered by alias.
+func (s *Storage) ListUrls(ctx context.Context, filter storage.ListFilter) (storage.LinkPage, error) {
+	const op = "storage.sqlite.ListUrls"
+
+	conditions := []string{"workspace = ?"}
+	args := []any{filter.Workspace}
+	if filter.Owner != "" {
+		conditions = append(conditions, "owner = ?")
+		args = append(args, filter.Owner)
+	}
+	if !filter.CreatedFrom.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.CreatedFrom.UTC())
+	}
+	if !filter.CreatedTo.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.CreatedTo.UTC())
+	}
+	if filter.Domain != "" {
+		conditions = append(conditions, "target_host = ?")
+		args = append(args, strings.ToLower(filter.Domain))
+	}
+	if filter.AliasPrefix != "" {
+		conditions = append(conditions, "alias >= ? AND alias < ?")
+		args = append(args, filter.AliasPrefix, storage.PrefixUpperBound(filter.AliasPrefix))
+	}
+	if filter.After != "" {
+		conditions = append(conditions, "alias > ?")
+		args = append(args, filter.After)
+	}
+
+	query := "SELECT " + linkColumns + " FROM url WHERE " + strings.Join(conditions, " AND ")
+	// one extra row tells whether there is a next page
+	query += " ORDER BY alias LIMIT ?"
+	args = append(args, filter.Limit+1)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return storage.LinkPage{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	links := []storage.Link{}
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return storage.LinkPage{}, fmt.Errorf("%s: scan url: %w", op, err)
+		}
+		links = append(links, link)
+	}
+	if err := rows.Err(); err != nil {
+		return storage.LinkPage{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return storage.NewLinkPage(links, filter.Limit), nil
+}
+
+// DeleteUrl removes the link together with its history.
+func (s *Storage) DeleteUrl(ctx context.Context, workspace string, alias string, owner string) error {
 	const op = "storage.sqlite.DeleteUrl"
 
-	stmt, err := s.db.Prepare("DELETE FROM url WHERE alias = ?")
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("%s: prepare statement: %w", op, err)
+		return fmt.Errorf("%s: begin transaction: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var linkOwner string
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT owner FROM url WHERE workspace = ? AND alias = ?",
+		workspace, alias,
+	).Scan(&linkOwner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrUrlNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("%s: select url: %w", op, err)
+	}
+
+	if !storage.IsOwner(linkOwner, owner) {
+		return storage.ErrUrlNotOwned
 	}
-	defer func() { _ = stmt.Close() }()
 
-	result, err := stmt.Exec(alias)
+	_, err = tx.ExecContext(ctx, "DELETE FROM url WHERE workspace = ? AND alias = ?", workspace, alias)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM url_history WHERE workspace = ? AND alias = ?", workspace, alias)
+	if err != nil {
+		return fmt.Errorf("%s: delete history: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit transaction: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) SaveAPIKey(ctx context.Context, key storage.APIKey) error {
+	const op = "storage.sqlite.SaveAPIKey"
+
+	result, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO api_key(hash, name, workspace, created_at)
+		SELECT ?, ?, ?, ? WHERE EXISTS (SELECT 1 FROM workspace WHERE id = ?)`,
+		key.Hash, key.Name, key.Workspace, key.CreatedAt.UTC(), key.Workspace,
+	)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%s: %w", op, storage.ErrAPIKeyExists)
+	}
 	if err != nil {
 		return fmt.Errorf("%s: execute statement: %w", op, err)
 	}
 
+	return requireWorkspace(result, op)
+}
+
+func (s *Storage) GetAPIKey(ctx context.Context, hash string) (storage.APIKey, error) {
+	const op = "storage.sqlite.GetAPIKey"
+
+	var key storage.APIKey
+	err := s.db.QueryRowContext(
+		ctx,
+		"SELECT hash, name, workspace, created_at FROM api_key WHERE hash = ?",
+		hash,
+	).Scan(&key.Hash, &key.Name, &key.Workspace, &key.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.APIKey{}, storage.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return storage.APIKey{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return key, nil
+}
+
+// requireWorkspace maps statements that touched no rows because the workspace
+// doesn't exist to ErrWorkspaceNotFound.
+func requireWorkspace(result sql.Result, op string) error {
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("%s: check affected rows: %w", op, err)
 	}
 
 	if rowsAffected == 0 {
-		return storage.ErrUrlNotFound
+		return storage.ErrWorkspaceNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) SaveWorkspace(ctx context.Context, ws storage.Workspace) error {
+	const op = "storage.sqlite.SaveWorkspace"
+
+	_, err := s.db.ExecContext(
+		ctx,
+		"INSERT INTO workspace(id, link_quota, links_created, created_at) VALUES(?, ?, ?, ?)",
+		ws.ID, ws.LinkQuota, ws.LinksCreated, ws.CreatedAt.UTC(),
+	)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%s: %w", op, storage.ErrWorkspaceExists)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetWorkspace(ctx context.Context, id string) (storage.Workspace, error) {
+	const op = "storage.sqlite.GetWorkspace"
+
+	var ws storage.Workspace
+	err := s.db.QueryRowContext(
+		ctx,
+		"SELECT id, link_quota, links_created, created_at FROM workspace WHERE id = ?",
+		id,
+	).Scan(&ws.ID, &ws.LinkQuota, &ws.LinksCreated, &ws.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Workspace{}, storage.ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return storage.Workspace{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return ws, nil
+}
+
+// ReserveLinks counts n links as created in the workspace, unless that
+// exceeds its quota.
+func (s *Storage) ReserveLinks(ctx context.Context, workspace string, n int) error {
+	const op = "storage.sqlite.ReserveLinks"
+
+	result, err := s.db.ExecContext(
+		ctx,
+		`UPDATE workspace SET links_created = links_created + ?
+		WHERE id = ? AND (link_quota = 0 OR links_created + ? <= link_quota)`,
+		n, workspace, n,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: check affected rows: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		if _, err := s.GetWorkspace(ctx, workspace); err != nil {
+			return err
+		}
+		return storage.ErrQuotaExceeded
 	}
 
 	return nil
 }
+
+// ReleaseLinks gives back n reserved links that were not created after all.
+func (s *Storage) ReleaseLinks(ctx context.Context, workspace string, n int) error {
+	const op = "storage.sqlite.ReleaseLinks"
+
+	result, err := s.db.ExecContext(
+		ctx,
+		"UPDATE workspace SET links_created = MAX(links_created - ?, 0) WHERE id = ?",
+		n, workspace,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return requireWorkspace(result, op)
+}
+
+func (s *Storage) SaveDomain(ctx context.Context, domain storage.Domain) error {
+	const op = "storage.sqlite.SaveDomain"
+
+	result, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO domain(host, workspace, created_at)
+		SELECT ?, ?, ? WHERE EXISTS (SELECT 1 FROM workspace WHERE id = ?)`,
+		domain.Host, domain.Workspace, domain.CreatedAt.UTC(), domain.Workspace,
+	)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%s: %w", op, storage.ErrDomainExists)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return requireWorkspace(result, op)
+}
+
+func (s *Storage) GetDomain(ctx context.Context, host string) (storage.Domain, error) {
+	const op = "storage.sqlite.GetDomain"
+
+	var domain storage.Domain
+	err := s.db.QueryRowContext(
+		ctx,
+		"SELECT host, workspace, created_at FROM domain WHERE host = ?",
+		host,
+	).Scan(&domain.Host, &domain.Workspace, &domain.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Domain{}, storage.ErrDomainNotFound
+	}
+	if err != nil {
+		return storage.Domain{}, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	return domain, nil
+}
+
+func (s *Storage) ListDomains(ctx context.Context, workspace string) ([]storage.Domain, error) {
+	const op = "storage.sqlite.ListDomains"
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT host, workspace, created_at FROM domain WHERE workspace = ? ORDER BY host",
+		workspace,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	domains := []storage.Domain{}
+	for rows.Next() {
+		var domain storage.Domain
+		if err := rows.Scan(&domain.Host, &domain.Workspace, &domain.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+		domains = append(domains, domain)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: iterate rows: %w", op, err)
+	}
+
+	return domains, nil
+}
+
+func (s *Storage) DeleteDomain(ctx context.Context, workspace string, host string) error {
+	const op = "storage.sqlite.DeleteDomain"
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM domain WHERE workspace = ? AND host = ?", workspace, host)
+	if err != nil {
+		return fmt.Errorf("%s: execute statement: %w", op, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: check affected rows: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrDomainNotFound
+	}
+
+	return nil
+}
+
+const linkColumns = "workspace, alias, url, created_at, updated_at, owner, expires_at, status, metadata"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanLink(row rowScanner) (storage.Link, error) {
+	var link storage.Link
+	var createdAt, updatedAt, expiresAt sql.NullTime
+	var metadata sql.NullString
+
+	err := row.Scan(
+		&link.Workspace,
+		&link.Alias,
+		&link.Url,
+		&createdAt,
+		&updatedAt,
+		&link.Owner,
+		&expiresAt,
+		&link.Status,
+		&metadata,
+	)
+	if err != nil {
+		return storage.Link{}, err
+	}
+
+	link.CreatedAt = createdAt.Time
+	link.UpdatedAt = updatedAt.Time
+	link.ExpiresAt = expiresAt.Time
+	if metadata.Valid && metadata.String != "" {
+		if err := json.Unmarshal([]byte(metadata.String), &link.Metadata); err != nil {
+			return storage.Link{}, fmt.Errorf("decode metadata: %w", err)
+		}
+	}
+
+	return link, nil
+}
+
+func encodeMetadata(metadata map[string]string) (sql.NullString, error) {
+	if len(metadata) == 0 {
+		return sql.NullString{}, nil
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("encode metadata: %w", err)
+	}
+
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
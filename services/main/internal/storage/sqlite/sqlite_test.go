@@ -0,0 +1,26 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/raisultan/url-shortener/services/main/internal/config"
+	"github.com/raisultan/url-shortener/services/main/internal/lib/logger/handlers/slogdiscard"
+	"github.com/raisultan/url-shortener/services/main/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		cfg := config.Storages{
+			SQLite: config.SQLiteConfig{StoragePath: filepath.Join(t.TempDir(), "storage.db")},
+		}
+
+		s, err := New(cfg, context.Background())
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close(context.Background(), slogdiscard.NewDiscardLogger()) })
+
+		return s
+	})
+}
@@ -2,9 +2,196 @@ package storage
 
 import (
 	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 var (
 	ErrUrlNotFound = errors.New("url not found")
 	ErrUrlExists   = errors.New("url exists")
+	ErrUrlExpired  = errors.New("url expired")
+	ErrUrlNotOwned = errors.New("url not owned")
+
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrAPIKeyExists   = errors.New("api key exists")
+
+	ErrWorkspaceNotFound = errors.New("workspace not found")
+	ErrWorkspaceExists   = errors.New("workspace exists")
+	ErrQuotaExceeded     = errors.New("link quota exceeded")
+
+	ErrDomainNotFound = errors.New("domain not found")
+	ErrDomainExists   = errors.New("domain exists")
+)
+
+// DefaultWorkspace holds links of clients and hosts not bound to another
+// workspace, storages create it on startup.
+const DefaultWorkspace = "default"
+
+type LinkStatus string
+
+const (
+	LinkStatusActive   LinkStatus = "active"
+	LinkStatusDisabled LinkStatus = "disabled"
 )
+
+// Link is a shortened url with its bookkeeping data. Zero ExpiresAt means
+// the link never expires.
+type Link struct {
+	Workspace string            `json:"workspace"`
+	Alias     string            `json:"alias"`
+	Url       string            `json:"url"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Owner     string            `json:"owner,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	Status    LinkStatus        `json:"status"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// HistoryEntry is a destination the link pointed to until ChangedAt.
+type HistoryEntry struct {
+	Workspace string    `json:"workspace"`
+	Alias     string    `json:"alias"`
+	Url       string    `json:"url"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// APIKey is a client credential, only the sha256 hash of the key is stored.
+// Name identifies the client and becomes the owner of links it creates.
+type APIKey struct {
+	Hash      string    `json:"hash"`
+	Name      string    `json:"name"`
+	Workspace string    `json:"workspace"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Workspace is an isolated alias namespace. LinkQuota limits the number of
+// links ever created in the workspace, zero means no limit.
+type Workspace struct {
+	ID           string    `json:"id"`
+	LinkQuota    int       `json:"link_quota"`
+	LinksCreated int       `json:"links_created"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Domain binds a host to the workspace whose links it redirects to.
+type Domain struct {
+	Host      string    `json:"host"`
+	Workspace string    `json:"workspace"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewLink returns an active link created now.
+func NewLink(workspace string, alias string, url string) Link {
+	now := time.Now().UTC()
+
+	return Link{
+		Workspace: workspace,
+		Alias:     alias,
+		Url:       url,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Status:    LinkStatusActive,
+	}
+}
+
+func (l Link) IsExpired() bool {
+	return IsExpired(l.ExpiresAt)
+}
+
+func (l Link) OwnedBy(owner string) bool {
+	return IsOwner(l.Owner, owner)
+}
+
+// IsOwner reports whether the owner may change a link owned by linkOwner,
+// empty owner is not restricted.
+func IsOwner(linkOwner string, owner string) bool {
+	return owner == "" || linkOwner == owner
+}
+
+// reservedAliases are paths the router serves itself ahead of redirects, links
+// with these aliases could never be followed.
+var reservedAliases = map[string]bool{
+	"metrics": true,
+	"healthz": true,
+	"readyz":  true,
+	"urls":    true,
+	"domains": true,
+}
+
+func IsReservedAlias(alias string) bool {
+	return reservedAliases[alias]
+}
+
+// IsExpired reports whether a url with the given expiration time is expired,
+// zero expiration time means the url never expires.
+func IsExpired(expiresAt time.Time) bool {
+	return !expiresAt.IsZero() && !time.Now().Before(expiresAt)
+}
+
+// ListFilter selects links of the workspace for listing, other zero fields
+// don't filter.
+type ListFilter struct {
+	Workspace string
+	Owner     string
+	// CreatedFrom is inclusive, CreatedTo is exclusive.
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	// Domain is the host of the destination url.
+	Domain      string
+	AliasPrefix string
+	// After is the alias the previous page ended with.
+	After string
+	// Limit is the page size, it must be positive.
+	Limit int
+}
+
+// LinkPage is a page of links ordered by alias. Next is the alias to pass as
+// ListFilter.After to get the next page, it is empty on the last page.
+type LinkPage struct {
+	Links []Link
+	Next  string
+}
+
+// NewLinkPage builds a page from up to limit+1 links fetched by a storage,
+// the extra link only signals that there is a next page.
+func NewLinkPage(links []Link, limit int) LinkPage {
+	if len(links) <= limit {
+		return LinkPage{Links: links}
+	}
+
+	links = links[:limit]
+
+	return LinkPage{Links: links, Next: links[limit-1].Alias}
+}
+
+// UrlHost returns the lowercased host of the url without port, storages keep
+// it next to the url to filter links by destination domain.
+func UrlHost(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(u.Hostname())
+}
+
+// Host returns the lowercased host without port, the form domains are stored in.
+func Host(hostport string) string {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// PrefixUpperBound returns an exclusive upper bound in byte order for strings
+// with the given prefix, so prefix matching can use an index as a range scan.
+// Strings continuing the prefix with U+10FFFF are not covered.
+func PrefixUpperBound(prefix string) string {
+	return prefix + string(utf8.MaxRune)
+}
@@ -0,0 +1,707 @@
+// Package storagetest implements the contract every url storage backend has
+// to satisfy. Backends invoke Run from their own tests.
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/raisultan/url-shortener/services/main/internal/lib/random"
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+const aliasSize = 12
+
+// timePrecision is the coarsest time precision among backends, MongoDB
+// stores milliseconds.
+const timePrecision = time.Millisecond
+
+// workspace holds the links of the suite, backends create it on startup.
+const workspace = storage.DefaultWorkspace
+
+type Storage interface {
+	SaveUrl(ctx context.Context, link storage.Link) error
+	SaveUrls(ctx context.Context, links []storage.Link) ([]error, error)
+	GetUrl(ctx context.Context, workspace string, alias string) (storage.Link, error)
+	DeleteUrl(ctx context.Context, workspace string, alias string, owner string) error
+	UpdateUrl(ctx context.Context, workspace string, alias string, url string, owner string) (storage.Link, error)
+	GetUrlHistory(ctx context.Context, workspace string, alias string) ([]storage.HistoryEntry, error)
+	ListUrls(ctx context.Context, filter storage.ListFilter) (storage.LinkPage, error)
+	SaveAPIKey(ctx context.Context, key storage.APIKey) error
+	GetAPIKey(ctx context.Context, hash string) (storage.APIKey, error)
+	SaveWorkspace(ctx context.Context, ws storage.Workspace) error
+	GetWorkspace(ctx context.Context, id string) (storage.Workspace, error)
+	ReserveLinks(ctx context.Context, workspace string, n int) error
+	ReleaseLinks(ctx context.Context, workspace string, n int) error
+	SaveDomain(ctx context.Context, domain storage.Domain) error
+	GetDomain(ctx context.Context, host string) (storage.Domain, error)
+	ListDomains(ctx context.Context, workspace string) ([]storage.Domain, error)
+	DeleteDomain(ctx context.Context, workspace string, host string) error
+}
+
+// Run executes the conformance suite. newStorage is called once per subtest
+// and is responsible for registering cleanup of what it creates. Aliases are
+// random, so backends that share state between subtests are fine.
+func Run(t *testing.T, newStorage func(t *testing.T) Storage) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s Storage)
+	}{
+		{name: "SaveGet", fn: testSaveGet},
+		{name: "SaveGetFullRecord", fn: testSaveGetFullRecord},
+		{name: "SaveDuplicate", fn: testSaveDuplicate},
+		{name: "SaveBatch", fn: testSaveBatch},
+		{name: "GetNotFound", fn: testGetNotFound},
+		{name: "Delete", fn: testDelete},
+		{name: "DeleteNotFound", fn: testDeleteNotFound},
+		{name: "SaveAfterDelete", fn: testSaveAfterDelete},
+		{name: "Expiration", fn: testExpiration},
+		{name: "DeleteExpired", fn: testDeleteExpired},
+		{name: "Update", fn: testUpdate},
+		{name: "UpdateNotFound", fn: testUpdateNotFound},
+		{name: "UpdateExpired", fn: testUpdateExpired},
+		{name: "HistoryNotFound", fn: testHistoryNotFound},
+		{name: "DeleteClearsHistory", fn: testDeleteClearsHistory},
+		{name: "ListPagination", fn: testListPagination},
+		{name: "ListFilters", fn: testListFilters},
+		{name: "Ownership", fn: testOwnership},
+		{name: "APIKeys", fn: testAPIKeys},
+		{name: "WorkspaceIsolation", fn: testWorkspaceIsolation},
+		{name: "Workspaces", fn: testWorkspaces},
+		{name: "Quota", fn: testQuota},
+		{name: "Domains", fn: testDomains},
+		{name: "CanceledContext", fn: testCanceledContext},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStorage(t))
+		})
+	}
+}
+
+func newLink(url string) storage.Link {
+	return storage.NewLink(workspace, random.NewRandomString(aliasSize), url)
+}
+
+func newExpiringLink(url string, expiresAt time.Time) storage.Link {
+	link := newLink(url)
+	link.ExpiresAt = expiresAt
+
+	return link
+}
+
+func requireUrl(t *testing.T, s Storage, alias string, url string) {
+	t.Helper()
+
+	link, err := s.GetUrl(context.Background(), workspace, alias)
+	require.NoError(t, err)
+	require.Equal(t, url, link.Url)
+}
+
+func testSaveGet(t *testing.T, s Storage) {
+	link := newLink("https://example.com/save-get")
+
+	require.NoError(t, s.SaveUrl(context.Background(), link))
+
+	requireUrl(t, s, link.Alias, "https://example.com/save-get")
+}
+
+func testSaveGetFullRecord(t *testing.T, s Storage) {
+	link := newExpiringLink("https://example.com/full", time.Now().Add(time.Hour))
+	link.Owner = "owner"
+	link.Status = storage.LinkStatusDisabled
+	link.Metadata = map[string]string{"campaign": "spring"}
+
+	require.NoError(t, s.SaveUrl(context.Background(), link))
+
+	got, err := s.GetUrl(context.Background(), workspace, link.Alias)
+	require.NoError(t, err)
+	require.Equal(t, link.Alias, got.Alias)
+	require.Equal(t, link.Url, got.Url)
+	require.Equal(t, link.Owner, got.Owner)
+	require.Equal(t, link.Status, got.Status)
+	require.Equal(t, link.Metadata, got.Metadata)
+	require.WithinDuration(t, link.CreatedAt, got.CreatedAt, timePrecision)
+	require.WithinDuration(t, link.UpdatedAt, got.UpdatedAt, timePrecision)
+	require.WithinDuration(t, link.ExpiresAt, got.ExpiresAt, timePrecision)
+}
+
+func testSaveDuplicate(t *testing.T, s Storage) {
+	ctx := context.Background()
+	link := newLink("https://example.com/first")
+
+	require.NoError(t, s.SaveUrl(ctx, link))
+
+	duplicate := storage.NewLink(workspace, link.Alias, "https://example.com/second")
+	err := s.SaveUrl(ctx, duplicate)
+	require.ErrorIs(t, err, storage.ErrUrlExists)
+
+	requireUrl(t, s, link.Alias, "https://example.com/first")
+}
+
+func testSaveBatch(t *testing.T, s Storage) {
+	ctx := context.Background()
+	existing := newLink("https://example.com/existing")
+	require.NoError(t, s.SaveUrl(ctx, existing))
+
+	first := newLink("https://example.com/first")
+	second := newExpiringLink("https://example.com/second", time.Now().Add(time.Hour))
+	second.Metadata = map[string]string{"campaign": "batch"}
+
+	errs, err := s.SaveUrls(ctx, []storage.Link{
+		first,
+		storage.NewLink(workspace, existing.Alias, "https://example.com/taken"),
+		second,
+		storage.NewLink(workspace, first.Alias, "https://example.com/repeated"),
+	})
+	require.NoError(t, err)
+	require.Len(t, errs, 4)
+	require.NoError(t, errs[0])
+	require.ErrorIs(t, errs[1], storage.ErrUrlExists)
+	require.NoError(t, errs[2])
+	require.ErrorIs(t, errs[3], storage.ErrUrlExists, "alias repeated within the batch")
+
+	requireUrl(t, s, first.Alias, "https://example.com/first")
+	requireUrl(t, s, existing.Alias, "https://example.com/existing")
+
+	got, err := s.GetUrl(ctx, workspace, second.Alias)
+	require.NoError(t, err)
+	require.Equal(t, second.Metadata, got.Metadata)
+	require.WithinDuration(t, second.ExpiresAt, got.ExpiresAt, timePrecision)
+
+	errs, err = s.SaveUrls(ctx, nil)
+	require.NoError(t, err)
+	require.Empty(t, errs)
+}
+
+func testGetNotFound(t *testing.T, s Storage) {
+	_, err := s.GetUrl(context.Background(), workspace, random.NewRandomString(aliasSize))
+	require.ErrorIs(t, err, storage.ErrUrlNotFound)
+}
+
+func testDelete(t *testing.T, s Storage) {
+	ctx := context.Background()
+	link := newLink("https://example.com/delete")
+	other := newLink("https://example.com/keep")
+
+	require.NoError(t, s.SaveUrl(ctx, link))
+	require.NoError(t, s.SaveUrl(ctx, other))
+
+	require.NoError(t, s.DeleteUrl(ctx, workspace, link.Alias, ""))
+
+	_, err := s.GetUrl(ctx, workspace, link.Alias)
+	require.ErrorIs(t, err, storage.ErrUrlNotFound)
+
+	requireUrl(t, s, other.Alias, "https://example.com/keep")
+}
+
+func testDeleteNotFound(t *testing.T, s Storage) {
+	ctx := context.Background()
+	link := newLink("https://example.com/delete-twice")
+
+	err := s.DeleteUrl(ctx, workspace, link.Alias, "")
+	require.ErrorIs(t, err, storage.ErrUrlNotFound)
+
+	require.NoError(t, s.SaveUrl(ctx, link))
+	require.NoError(t, s.DeleteUrl(ctx, workspace, link.Alias, ""))
+
+	err = s.DeleteUrl(ctx, workspace, link.Alias, "")
+	require.ErrorIs(t, err, storage.ErrUrlNotFound)
+}
+
+func testSaveAfterDelete(t *testing.T, s Storage) {
+	ctx := context.Background()
+	link := newLink("https://example.com/old")
+
+	require.NoError(t, s.SaveUrl(ctx, link))
+	require.NoError(t, s.DeleteUrl(ctx, workspace, link.Alias, ""))
+	require.NoError(t, s.SaveUrl(ctx, storage.NewLink(workspace, link.Alias, "https://example.com/new")))
+
+	requireUrl(t, s, link.Alias, "https://example.com/new")
+}
+
+func testExpiration(t *testing.T, s Storage) {
+	ctx := context.Background()
+	expired := newExpiringLink("https://example.com/expired", time.Now().Add(-time.Minute))
+	alive := newExpiringLink("https://example.com/alive", time.Now().Add(time.Hour))
+
+	require.NoError(t, s.SaveUrl(ctx, expired))
+	require.NoError(t, s.SaveUrl(ctx, alive))
+
+	_, err := s.GetUrl(ctx, workspace, expired.Alias)
+	require.ErrorIs(t, err, storage.ErrUrlExpired)
+
+	requireUrl(t, s, alive.Alias, "https://example.com/alive")
+
+	err = s.SaveUrl(ctx, storage.NewLink(workspace, expired.Alias, "https://example.com/reuse"))
+	require.ErrorIs(t, err, storage.ErrUrlExists, "expired alias is still taken")
+}
+
+func testDeleteExpired(t *testing.T, s Storage) {
+	ctx := context.Background()
+	link := newExpiringLink("https://example.com/expired", time.Now().Add(-time.Minute))
+
+	require.NoError(t, s.SaveUrl(ctx, link))
+	require.NoError(t, s.DeleteUrl(ctx, workspace, link.Alias, ""))
+
+	_, err := s.GetUrl(ctx, workspace, link.Alias)
+	require.ErrorIs(t, err, storage.ErrUrlNotFound)
+}
+
+func testUpdate(t *testing.T, s Storage) {
+	ctx := context.Background()
+	link := newLink("https://example.com/v1")
+	link.Metadata = map[string]string{"team": "growth"}
+
+	require.NoError(t, s.SaveUrl(ctx, link))
+
+	history, err := s.GetUrlHistory(ctx, workspace, link.Alias)
+	require.NoError(t, err)
+	require.Empty(t, history)
+
+	updated, err := s.UpdateUrl(ctx, workspace, link.Alias, "https://example.com/v2", "")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/v2", updated.Url)
+	require.Equal(t, link.Metadata, updated.Metadata)
+	require.False(t, updated.UpdatedAt.Before(link.UpdatedAt.Truncate(timePrecision)))
+
+	_, err = s.UpdateUrl(ctx, workspace, link.Alias, "https://example.com/v3", "")
+	require.NoError(t, err)
+
+	got, err := s.GetUrl(ctx, workspace, link.Alias)
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/v3", got.Url)
+	require.WithinDuration(t, link.CreatedAt, got.CreatedAt, timePrecision, "update must keep creation time")
+
+	history, err = s.GetUrlHistory(ctx, workspace, link.Alias)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, "https://example.com/v2", history[0].Url, "latest change goes first")
+	require.Equal(t, "https://example.com/v1", history[1].Url)
+	for _, entry := range history {
+		require.Equal(t, link.Alias, entry.Alias)
+		require.False(t, entry.ChangedAt.IsZero())
+	}
+}
+
+func testUpdateNotFound(t *testing.T, s Storage) {
+	_, err := s.UpdateUrl(context.Background(), workspace, random.NewRandomString(aliasSize), "https://example.com", "")
+	require.ErrorIs(t, err, storage.ErrUrlNotFound)
+}
+
+func testUpdateExpired(t *testing.T, s Storage) {
+	ctx := context.Background()
+	link := newExpiringLink("https://example.com/expired", time.Now().Add(-time.Minute))
+
+	require.NoError(t, s.SaveUrl(ctx, link))
+
+	_, err := s.UpdateUrl(ctx, workspace, link.Alias, "https://example.com/revived", "")
+	require.ErrorIs(t, err, storage.ErrUrlExpired)
+
+	history, err := s.GetUrlHistory(ctx, workspace, link.Alias)
+	require.NoError(t, err)
+	require.Empty(t, history)
+}
+
+func testHistoryNotFound(t *testing.T, s Storage) {
+	_, err := s.GetUrlHistory(context.Background(), workspace, random.NewRandomString(aliasSize))
+	require.ErrorIs(t, err, storage.ErrUrlNotFound)
+}
+
+func testDeleteClearsHistory(t *testing.T, s Storage) {
+	ctx := context.Background()
+	link := newLink("https://example.com/v1")
+
+	require.NoError(t, s.SaveUrl(ctx, link))
+	_, err := s.UpdateUrl(ctx, workspace, link.Alias, "https://example.com/v2", "")
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteUrl(ctx, workspace, link.Alias, ""))
+
+	require.NoError(t, s.SaveUrl(ctx, storage.NewLink(workspace, link.Alias, "https://example.com/other")))
+
+	history, err := s.GetUrlHistory(ctx, workspace, link.Alias)
+	require.NoError(t, err)
+	require.Empty(t, history, "history of a deleted link must not leak into a new one")
+}
+
+func aliases(links []storage.Link) []string {
+	res := make([]string, 0, len(links))
+	for _, link := range links {
+		res = append(res, link.Alias)
+	}
+
+	return res
+}
+
+func testListPagination(t *testing.T, s Storage) {
+	ctx := context.Background()
+	prefix := random.NewRandomString(aliasSize)
+
+	for _, suffix := range []string{"e", "a", "d", "b", "c"} {
+		require.NoError(t, s.SaveUrl(ctx, storage.NewLink(workspace, prefix+suffix, "https://example.com/"+suffix)))
+	}
+
+	var got []string
+	filter := storage.ListFilter{Workspace: workspace, AliasPrefix: prefix, Limit: 2}
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 3, "pagination must stop")
+
+		page, err := s.ListUrls(ctx, filter)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(page.Links), 2)
+		got = append(got, aliases(page.Links)...)
+
+		if page.Next == "" {
+			break
+		}
+		filter.After = page.Next
+	}
+
+	require.Equal(t, []string{prefix + "a", prefix + "b", prefix + "c", prefix + "d", prefix + "e"}, got)
+}
+
+func testListFilters(t *testing.T, s Storage) {
+	ctx := context.Background()
+	prefix := random.NewRandomString(aliasSize)
+	base := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+
+	links := []struct {
+		suffix  string
+		url     string
+		owner   string
+		created time.Time
+	}{
+		{suffix: "a", url: "https://Example.com/a", owner: "alice", created: base},
+		{suffix: "b", url: "https://example.com:8443/b", owner: "bob", created: base.Add(time.Minute)},
+		{suffix: "c", url: "https://other.org/c", owner: "alice", created: base.Add(2 * time.Minute)},
+	}
+	for _, l := range links {
+		link := storage.NewLink(workspace, prefix+l.suffix, l.url)
+		link.Owner = l.owner
+		link.CreatedAt = l.created
+		require.NoError(t, s.SaveUrl(ctx, link))
+	}
+	require.NoError(t, s.SaveUrl(ctx, storage.NewLink(workspace, random.NewRandomString(aliasSize), "https://example.com")))
+
+	tests := []struct {
+		name   string
+		filter storage.ListFilter
+		want   []string
+	}{
+		{name: "prefix", filter: storage.ListFilter{}, want: []string{"a", "b", "c"}},
+		{name: "owner", filter: storage.ListFilter{Owner: "alice"}, want: []string{"a", "c"}},
+		{name: "domain", filter: storage.ListFilter{Domain: "EXAMPLE.com"}, want: []string{"a", "b"}},
+		{
+			name:   "created range",
+			filter: storage.ListFilter{CreatedFrom: base.Add(time.Minute), CreatedTo: base.Add(2 * time.Minute)},
+			want:   []string{"b"},
+		},
+		{
+			name:   "combined",
+			filter: storage.ListFilter{Owner: "alice", Domain: "other.org", CreatedFrom: base},
+			want:   []string{"c"},
+		},
+		{name: "after", filter: storage.ListFilter{After: prefix + "a"}, want: []string{"b", "c"}},
+		{name: "nothing", filter: storage.ListFilter{Owner: "nobody"}, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.Workspace = workspace
+			tt.filter.AliasPrefix = prefix
+			tt.filter.Limit = 10
+
+			page, err := s.ListUrls(ctx, tt.filter)
+			require.NoError(t, err)
+			require.Empty(t, page.Next)
+
+			want := make([]string, 0, len(tt.want))
+			for _, suffix := range tt.want {
+				want = append(want, prefix+suffix)
+			}
+			require.Equal(t, want, aliases(page.Links))
+		})
+	}
+}
+
+func testOwnership(t *testing.T, s Storage) {
+	ctx := context.Background()
+	link := newLink("https://example.com/owned")
+	link.Owner = "owner-" + random.NewRandomString(aliasSize)
+
+	require.NoError(t, s.SaveUrl(ctx, link))
+
+	_, err := s.UpdateUrl(ctx, workspace, link.Alias, "https://example.com/stolen", "intruder")
+	require.ErrorIs(t, err, storage.ErrUrlNotOwned)
+
+	err = s.DeleteUrl(ctx, workspace, link.Alias, "intruder")
+	require.ErrorIs(t, err, storage.ErrUrlNotOwned)
+
+	requireUrl(t, s, link.Alias, "https://example.com/owned")
+
+	_, err = s.UpdateUrl(ctx, workspace, link.Alias, "https://example.com/moved", link.Owner)
+	require.NoError(t, err)
+	requireUrl(t, s, link.Alias, "https://example.com/moved")
+
+	require.NoError(t, s.DeleteUrl(ctx, workspace, link.Alias, link.Owner))
+
+	_, err = s.GetUrl(ctx, workspace, link.Alias)
+	require.ErrorIs(t, err, storage.ErrUrlNotFound)
+}
+
+func testAPIKeys(t *testing.T, s Storage) {
+	ctx := context.Background()
+	key := storage.APIKey{
+		Hash:      random.NewRandomString(64),
+		Name:      "client-" + random.NewRandomString(aliasSize),
+		Workspace: workspace,
+		CreatedAt: time.Now().UTC().Truncate(timePrecision),
+	}
+
+	_, err := s.GetAPIKey(ctx, key.Hash)
+	require.ErrorIs(t, err, storage.ErrAPIKeyNotFound)
+
+	require.NoError(t, s.SaveAPIKey(ctx, key))
+
+	got, err := s.GetAPIKey(ctx, key.Hash)
+	require.NoError(t, err)
+	require.Equal(t, key.Name, got.Name)
+	require.Equal(t, key.Workspace, got.Workspace)
+	require.True(t, key.CreatedAt.Equal(got.CreatedAt))
+
+	err = s.SaveAPIKey(ctx, key)
+	require.ErrorIs(t, err, storage.ErrAPIKeyExists)
+
+	sameName := key
+	sameName.Hash = random.NewRandomString(64)
+	err = s.SaveAPIKey(ctx, sameName)
+	require.ErrorIs(t, err, storage.ErrAPIKeyExists)
+
+	orphan := storage.APIKey{Hash: random.NewRandomString(64), Name: "orphan", Workspace: newWorkspaceID()}
+	err = s.SaveAPIKey(ctx, orphan)
+	require.ErrorIs(t, err, storage.ErrWorkspaceNotFound)
+}
+
+func newWorkspaceID() string {
+	return "ws-" + random.NewRandomString(aliasSize)
+}
+
+func newWorkspace(t *testing.T, s Storage, quota int) storage.Workspace {
+	t.Helper()
+
+	ws := storage.Workspace{
+		ID:        newWorkspaceID(),
+		LinkQuota: quota,
+		CreatedAt: time.Now().UTC().Truncate(timePrecision),
+	}
+	require.NoError(t, s.SaveWorkspace(context.Background(), ws))
+
+	return ws
+}
+
+func testWorkspaceIsolation(t *testing.T, s Storage) {
+	ctx := context.Background()
+	other := newWorkspace(t, s, 0)
+	link := newLink("https://example.com/default")
+
+	require.NoError(t, s.SaveUrl(ctx, link))
+
+	_, err := s.GetUrl(ctx, other.ID, link.Alias)
+	require.ErrorIs(t, err, storage.ErrUrlNotFound)
+
+	err = s.DeleteUrl(ctx, other.ID, link.Alias, "")
+	require.ErrorIs(t, err, storage.ErrUrlNotFound)
+
+	_, err = s.UpdateUrl(ctx, other.ID, link.Alias, "https://example.com/hijacked", "")
+	require.ErrorIs(t, err, storage.ErrUrlNotFound)
+
+	same := storage.NewLink(other.ID, link.Alias, "https://example.com/other")
+	require.NoError(t, s.SaveUrl(ctx, same), "aliases are unique per workspace")
+
+	errs, err := s.SaveUrls(ctx, []storage.Link{storage.NewLink(other.ID, link.Alias, "https://example.com/again")})
+	require.NoError(t, err)
+	require.ErrorIs(t, errs[0], storage.ErrUrlExists)
+
+	got, err := s.GetUrl(ctx, other.ID, link.Alias)
+	require.NoError(t, err)
+	require.Equal(t, other.ID, got.Workspace)
+	require.Equal(t, "https://example.com/other", got.Url)
+
+	requireUrl(t, s, link.Alias, "https://example.com/default")
+
+	_, err = s.UpdateUrl(ctx, other.ID, link.Alias, "https://example.com/other-v2", "")
+	require.NoError(t, err)
+
+	history, err := s.GetUrlHistory(ctx, workspace, link.Alias)
+	require.NoError(t, err)
+	require.Empty(t, history)
+
+	page, err := s.ListUrls(ctx, storage.ListFilter{Workspace: other.ID, Limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, []string{link.Alias}, aliases(page.Links))
+
+	require.NoError(t, s.DeleteUrl(ctx, other.ID, link.Alias, ""))
+	requireUrl(t, s, link.Alias, "https://example.com/default")
+}
+
+func testWorkspaces(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	_, err := s.GetWorkspace(ctx, newWorkspaceID())
+	require.ErrorIs(t, err, storage.ErrWorkspaceNotFound)
+
+	_, err = s.GetWorkspace(ctx, workspace)
+	require.NoError(t, err, "default workspace is created on startup")
+
+	ws := newWorkspace(t, s, 5)
+
+	got, err := s.GetWorkspace(ctx, ws.ID)
+	require.NoError(t, err)
+	require.Equal(t, ws.ID, got.ID)
+	require.Equal(t, 5, got.LinkQuota)
+	require.Zero(t, got.LinksCreated)
+	require.True(t, ws.CreatedAt.Equal(got.CreatedAt))
+
+	err = s.SaveWorkspace(ctx, ws)
+	require.ErrorIs(t, err, storage.ErrWorkspaceExists)
+}
+
+func testQuota(t *testing.T, s Storage) {
+	ctx := context.Background()
+	ws := newWorkspace(t, s, 3)
+
+	require.NoError(t, s.ReserveLinks(ctx, ws.ID, 2))
+
+	err := s.ReserveLinks(ctx, ws.ID, 2)
+	require.ErrorIs(t, err, storage.ErrQuotaExceeded)
+
+	require.NoError(t, s.ReserveLinks(ctx, ws.ID, 1))
+
+	err = s.ReserveLinks(ctx, ws.ID, 1)
+	require.ErrorIs(t, err, storage.ErrQuotaExceeded)
+
+	require.NoError(t, s.ReleaseLinks(ctx, ws.ID, 2))
+	require.NoError(t, s.ReserveLinks(ctx, ws.ID, 2))
+
+	got, err := s.GetWorkspace(ctx, ws.ID)
+	require.NoError(t, err)
+	require.Equal(t, 3, got.LinksCreated)
+
+	unlimited := newWorkspace(t, s, 0)
+	require.NoError(t, s.ReserveLinks(ctx, unlimited.ID, 1000))
+
+	err = s.ReserveLinks(ctx, newWorkspaceID(), 1)
+	require.ErrorIs(t, err, storage.ErrWorkspaceNotFound)
+}
+
+// newHost returns a random host in the form domains are stored in.
+func newHost() string {
+	return storage.Host(random.NewRandomString(aliasSize) + ".example.com")
+}
+
+func testDomains(t *testing.T, s Storage) {
+	ctx := context.Background()
+	ws := newWorkspace(t, s, 0)
+	domain := storage.Domain{
+		Host:      newHost(),
+		Workspace: ws.ID,
+		CreatedAt: time.Now().UTC().Truncate(timePrecision),
+	}
+
+	_, err := s.GetDomain(ctx, domain.Host)
+	require.ErrorIs(t, err, storage.ErrDomainNotFound)
+
+	require.NoError(t, s.SaveDomain(ctx, domain))
+
+	got, err := s.GetDomain(ctx, domain.Host)
+	require.NoError(t, err)
+	require.Equal(t, domain.Workspace, got.Workspace)
+	require.True(t, domain.CreatedAt.Equal(got.CreatedAt))
+
+	taken := domain
+	taken.Workspace = workspace
+	err = s.SaveDomain(ctx, taken)
+	require.ErrorIs(t, err, storage.ErrDomainExists)
+
+	orphan := storage.Domain{Host: newHost(), Workspace: newWorkspaceID()}
+	err = s.SaveDomain(ctx, orphan)
+	require.ErrorIs(t, err, storage.ErrWorkspaceNotFound)
+
+	// "." sorts before alphanumerics, so "0." sorts before any other host
+	second := storage.Domain{Host: "0." + domain.Host, Workspace: ws.ID, CreatedAt: time.Now().UTC()}
+	require.NoError(t, s.SaveDomain(ctx, second))
+
+	domains, err := s.ListDomains(ctx, ws.ID)
+	require.NoError(t, err)
+	require.Len(t, domains, 2)
+	require.Equal(t, second.Host, domains[0].Host, "domains are ordered by host")
+	require.Equal(t, domain.Host, domains[1].Host)
+
+	err = s.DeleteDomain(ctx, workspace, domain.Host)
+	require.ErrorIs(t, err, storage.ErrDomainNotFound, "domain of another workspace")
+
+	require.NoError(t, s.DeleteDomain(ctx, ws.ID, domain.Host))
+
+	_, err = s.GetDomain(ctx, domain.Host)
+	require.ErrorIs(t, err, storage.ErrDomainNotFound)
+
+	err = s.DeleteDomain(ctx, ws.ID, domain.Host)
+	require.ErrorIs(t, err, storage.ErrDomainNotFound)
+
+	domains, err = s.ListDomains(ctx, ws.ID)
+	require.NoError(t, err)
+	require.Len(t, domains, 1)
+
+	empty, err := s.ListDomains(ctx, newWorkspaceID())
+	require.NoError(t, err)
+	require.Empty(t, empty)
+}
+
+func testCanceledContext(t *testing.T, s Storage) {
+	link := newLink("https://example.com/canceled")
+	require.NoError(t, s.SaveUrl(context.Background(), link))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := s.SaveUrl(ctx, newLink("https://example.com/canceled"))
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = s.SaveUrls(ctx, []storage.Link{newLink("https://example.com/canceled")})
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = s.GetUrl(ctx, workspace, link.Alias)
+	require.ErrorIs(t, err, context.Canceled)
+
+	err = s.DeleteUrl(ctx, workspace, link.Alias, "")
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = s.GetAPIKey(ctx, "hash")
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = s.UpdateUrl(ctx, workspace, link.Alias, "https://example.com/updated", "")
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = s.GetUrlHistory(ctx, workspace, link.Alias)
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = s.ListUrls(ctx, storage.ListFilter{Workspace: workspace, Limit: 1})
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = s.GetWorkspace(ctx, workspace)
+	require.ErrorIs(t, err, context.Canceled)
+
+	err = s.ReserveLinks(ctx, workspace, 1)
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = s.GetDomain(ctx, "example.com")
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = s.ListDomains(ctx, workspace)
+	require.ErrorIs(t, err, context.Canceled)
+
+	requireUrl(t, s, link.Alias, "https://example.com/canceled")
+}
@@ -0,0 +1,46 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/raisultan/url-shortener/services/main/internal/storage"
+)
+
+type Saver interface {
+	SaveWorkspace(ctx context.Context, ws storage.Workspace) error
+	SaveDomain(ctx context.Context, domain storage.Domain) error
+}
+
+// Create stores a new workspace allowed to create up to linkQuota links, zero
+// means no limit. Non-empty host is bound to the workspace, so redirects from
+// it resolve aliases of the workspace.
+func Create(ctx context.Context, saver Saver, id string, linkQuota int, host string) error {
+	const op = "workspace.Create"
+
+	if id == "" {
+		return fmt.Errorf("%s: id is empty", op)
+	}
+	if linkQuota < 0 {
+		return fmt.Errorf("%s: link quota must not be negative", op)
+	}
+
+	now := time.Now().UTC()
+
+	err := saver.SaveWorkspace(ctx, storage.Workspace{ID: id, LinkQuota: linkQuota, CreatedAt: now})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if host == "" {
+		return nil
+	}
+
+	err = saver.SaveDomain(ctx, storage.Domain{Host: storage.Host(host), Workspace: id, CreatedAt: now})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
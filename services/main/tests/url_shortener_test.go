@@ -2,11 +2,13 @@ package tests
 
 import (
 	"fmt"
+	"github.com/raisultan/url-shortener/lib/api/response"
 	"github.com/raisultan/url-shortener/services/main/internal/http-server/handlers/url/save"
 	"github.com/raisultan/url-shortener/services/main/internal/lib/api"
 	"github.com/raisultan/url-shortener/services/main/internal/lib/random"
 	"net/http"
 	"net/url"
+	"os"
 	"testing"
 
 	"github.com/brianvoe/gofakeit/v6"
@@ -18,6 +20,9 @@ const (
 	host = "localhost:8080"
 )
 
+// apiKey authenticates API requests, create one with -create-api-key.
+var apiKey = os.Getenv("URL_SHORTENER_API_KEY")
+
 func TestURLShortener_HappyPath(t *testing.T) {
 	u := url.URL{
 		Scheme: "http",
@@ -26,6 +31,7 @@ func TestURLShortener_HappyPath(t *testing.T) {
 	e := httpexpect.Default(t, u.String())
 
 	e.POST("/url").
+		WithHeader("X-API-Key", apiKey).
 		WithJSON(save.Request{
 			Url:   gofakeit.URL(),
 			Alias: random.NewRandomString(10),
@@ -39,26 +45,30 @@ func TestURLShortener_HappyPath(t *testing.T) {
 //nolint:funlen
 func TestURLShortener_SaveRedirect(t *testing.T) {
 	testCases := []struct {
-		name  string
-		url   string
-		alias string
-		error string
+		name   string
+		url    string
+		alias  string
+		error  string
+		status int
 	}{
 		{
-			name:  "Valid URL",
-			url:   gofakeit.URL(),
-			alias: gofakeit.Word() + gofakeit.Word(),
+			name:   "Valid URL",
+			url:    gofakeit.URL(),
+			alias:  gofakeit.Word() + gofakeit.Word(),
+			status: http.StatusOK,
 		},
 		{
-			name:  "Invalid URL",
-			url:   "invalid_url",
-			alias: gofakeit.Word(),
-			error: "field Url is not a valid URL",
+			name:   "Invalid URL",
+			url:    "invalid_url",
+			alias:  gofakeit.Word(),
+			error:  "field Url is not a valid URL",
+			status: http.StatusUnprocessableEntity,
 		},
 		{
-			name:  "Empty Alias",
-			url:   gofakeit.URL(),
-			alias: "",
+			name:   "Empty Alias",
+			url:    gofakeit.URL(),
+			alias:  "",
+			status: http.StatusOK,
 		},
 	}
 
@@ -74,12 +84,13 @@ func TestURLShortener_SaveRedirect(t *testing.T) {
 			// Save
 
 			resp := e.POST("/url").
+				WithHeader("X-API-Key", apiKey).
 				WithJSON(save.Request{
 					Url:   tc.url,
 					Alias: tc.alias,
 				}).
-				Expect().Status(http.StatusOK).
-				JSON().Object()
+				Expect().Status(tc.status).
+				JSON(contentOpts(tc.error != "")).Object()
 
 			if tc.error != "" {
 				resp.NotContainsKey("alias")
@@ -104,6 +115,15 @@ func TestURLShortener_SaveRedirect(t *testing.T) {
 	}
 }
 
+// contentOpts expects failed requests to be answered with problem details.
+func contentOpts(isError bool) httpexpect.ContentOpts {
+	if isError {
+		return httpexpect.ContentOpts{MediaType: response.ContentTypeProblem}
+	}
+
+	return httpexpect.ContentOpts{MediaType: "application/json"}
+}
+
 func testRedirect(t *testing.T, alias string, urlToRedirect string) {
 	u := url.URL{
 		Scheme: "http",
@@ -122,17 +142,20 @@ func TestURLShortener_Delete(t *testing.T) {
 		name             string
 		alias            string
 		expectedResponse string
+		expectedStatus   int
 		isError          bool
 	}{
 		{
 			name:             "Valid Alias",
 			alias:            gofakeit.Word() + gofakeit.Word(),
 			expectedResponse: "OK",
+			expectedStatus:   http.StatusOK,
 		},
 		{
 			name:             "Invalid Alias",
 			alias:            gofakeit.Word(),
 			expectedResponse: "alias not found",
+			expectedStatus:   http.StatusNotFound,
 			isError:          true,
 		},
 	}
@@ -148,6 +171,7 @@ func TestURLShortener_Delete(t *testing.T) {
 
 			if tc.expectedResponse == "OK" {
 				e.POST("/url").
+					WithHeader("X-API-Key", apiKey).
 					WithJSON(save.Request{
 						Url:   gofakeit.URL(),
 						Alias: tc.alias,
@@ -157,8 +181,9 @@ func TestURLShortener_Delete(t *testing.T) {
 			}
 
 			deleteResp := e.DELETE(fmt.Sprintf("/%s", tc.alias)).
-				Expect().Status(http.StatusOK).
-				JSON().Object()
+				WithHeader("X-API-Key", apiKey).
+				Expect().Status(tc.expectedStatus).
+				JSON(contentOpts(tc.isError)).Object()
 
 			if tc.isError == true {
 				deleteResp.Value("error").String().IsEqual(tc.expectedResponse)